@@ -1,15 +1,21 @@
 package utils
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/bytedance/sonic"
@@ -20,42 +26,686 @@ import (
 	"github.com/xuri/excelize/v2"
 )
 
-/* ConvertExcelToTSV converts the Excel file to the text file by delimiter. */
+/*
+ConvertExcel converts the Excel file to the text file by delimiter,
+every sheet is streamed row by row into its own file.
+*/
 func ConvertExcel(filePath, ext string, delimiter rune) error {
-	excelFile, err := excelize.OpenFile(filePath)
+	_, err := ConvertExcelWithOptions(filePath, ExcelOptions{Ext: ext, Delimiter: delimiter})
+	return err
+}
+
+/* DefaultExcelNameTemplate is the output file name template used when ExcelOptions.NameTemplate is empty. */
+const DefaultExcelNameTemplate = "{name}_{sheet}{ext}"
+
+/*
+ExcelOptions configures ConvertExcelWithOptions.
+
+Sheets are selected by IncludeSheets/IncludePattern (all sheets when both are empty)
+and then removed by ExcludeSheets/ExcludePattern.
+NameTemplate supports the {name}, {sheet}, {index} and {ext} placeholders,
+{name} is the source file name without extension and {index} is the 1-based sheet position.
+FillMerged repeats the top-left value over merged ranges, FormulaText writes formulas as "=SUM(A1:A2)"
+instead of their cached results and ISODates renders date and time cells in ISO-8601.
+Workers above 1 converts that many sheets concurrently, the output is the same as the sequential conversion.
+A NameTemplate without {sheet} or {index} is rejected when several sheets are selected, they would share a file.
+A failed sheet doesn't stop the others, the failures are returned as SheetErrors.
+Password opens an encrypted workbook, a missing or wrong one returns an *ExcelPasswordError.
+DelimiterName, like "tab" or "0x1F", overrides Delimiter with the character ParseDelimiter reads in it.
+*/
+type ExcelOptions struct {
+	Ext            string
+	Delimiter      rune
+	DelimiterName  string
+	IncludeSheets  []string
+	IncludePattern *regexp.Regexp
+	ExcludeSheets  []string
+	ExcludePattern *regexp.Regexp
+	SkipHidden     bool
+	OutputDir      string
+	NameTemplate   string
+	RawCellValue   bool
+	FillMerged     bool
+	FormulaText    bool
+	ISODates       bool
+	Workers        int
+	Password       string
+}
+
+/*
+ConvertExcelWithOptions converts the selected sheets of the Excel file to text files,
+returns the paths of the files it produced. OpenDocument spreadsheets are read as well,
+recognized by their .ods extension or their content.
+*/
+func ConvertExcelWithOptions(filePath string, opts ExcelOptions) ([]string, error) {
+	delimiter, err := opts.delimiter()
+	if err != nil {
+		return nil, err
+	}
+	return convertExcelSheets(filePath, ".csv", opts, delimitedSheetWriter(delimiter))
+}
+
+/*
+JSONLOptions configures ConvertExcelToJSONL.
+
+HeaderRow is the 1-based row holding the keys, 1 by default, rows above it are skipped.
+Empty cells are left out unless EmptyAsNull is set, CoerceTypes writes integers, decimals and true/false as JSON numbers and booleans.
+*/
+type JSONLOptions struct {
+	ExcelOptions
+	HeaderRow   int
+	EmptyAsNull bool
+	CoerceTypes bool
+}
+
+/*
+ConvertExcelToJSONL converts the selected sheets of the Excel file to JSON Lines,
+every row below the header row becomes an object keyed by the header. Returns the paths of the files it produced.
+*/
+func ConvertExcelToJSONL(filePath string, opts JSONLOptions) ([]string, error) {
+	return convertExcelSheets(filePath, ".jsonl", opts.ExcelOptions, jsonlSheetWriter(opts))
+}
+
+/* SheetWriterFactory returns the writer a sheet is converted to, the conversion closes it once the sheet is written. */
+type SheetWriterFactory func(sheet string) (io.WriteCloser, error)
+
+/*
+ConvertExcelReader converts the selected sheets of the Excel workbook read from r by delimiter,
+every sheet is written to the writer create returns for it. An OpenDocument spreadsheet is recognized by its content.
+Ext, OutputDir and NameTemplate are ignored
+and create is called from several goroutines when Workers is above 1. Returns the names of the converted sheets.
+*/
+func ConvertExcelReader(r io.Reader, opts ExcelOptions, create SheetWriterFactory) ([]string, error) {
+	delimiter, err := opts.delimiter()
+	if err != nil {
+		return nil, err
+	}
+	return convertExcelReader(r, opts, delimitedSheetWriter(delimiter), create)
+}
+
+/* ConvertExcelReaderToJSONL is ConvertExcelReader writing JSON Lines like ConvertExcelToJSONL. */
+func ConvertExcelReaderToJSONL(r io.Reader, opts JSONLOptions, create SheetWriterFactory) ([]string, error) {
+	return convertExcelReader(r, opts.ExcelOptions, jsonlSheetWriter(opts), create)
+}
+
+/* sheetWriter writes the rows returned by next until io.EOF to w. */
+type sheetWriter func(next func() ([]string, error), w io.Writer) error
+
+/* delimitedSheetWriter returns the sheetWriter writing rows by delimiter, ',' when it is 0. */
+func delimitedSheetWriter(delimiter rune) sheetWriter {
+	if delimiter == 0 {
+		delimiter = ','
+	}
+	return func(next func() ([]string, error), w io.Writer) error {
+		return writeDelimitedRows(next, w, delimiter)
+	}
+}
+
+/* jsonlSheetWriter returns the sheetWriter writing rows as JSON Lines. */
+func jsonlSheetWriter(opts JSONLOptions) sheetWriter {
+	if opts.HeaderRow < 1 {
+		opts.HeaderRow = 1
+	}
+	return func(next func() ([]string, error), w io.Writer) error {
+		return writeJSONLRows(next, w, opts)
+	}
+}
+
+/* convertExcelSheets writes every selected sheet of the Excel file to its own file, ext is the default extension. */
+func convertExcelSheets(filePath, ext string, opts ExcelOptions, write sheetWriter) ([]string, error) {
+	if opts.Ext == "" {
+		opts.Ext = ext
+	}
+	if opts.NameTemplate == "" {
+		opts.NameTemplate = DefaultExcelNameTemplate
+	}
+	if opts.OutputDir == "" {
+		opts.OutputDir = filepath.Dir(filePath)
+	}
+	base := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	fileName := func(job sheetJob) string {
+		return filepath.Join(opts.OutputDir, strings.NewReplacer(
+			"{name}", base,
+			"{sheet}", job.sheet,
+			"{index}", strconv.Itoa(job.index),
+			"{ext}", opts.Ext,
+		).Replace(opts.NameTemplate))
+	}
+
+	src, err := fileExcelSource(filePath, opts.Password)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	jobs, err := convertWorkbook(src, opts, write, func(job sheetJob, convert func(io.Writer) error) error {
+		return writePartFile(fileName(job), convert)
+	})
+	var files []string
+	for _, job := range jobs {
+		files = append(files, fileName(job))
+	}
+	return files, err
+}
+
+/* convertExcelReader writes every selected sheet of the workbook read from r to the writer create returns for it. */
+func convertExcelReader(r io.Reader, opts ExcelOptions, write sheetWriter, create SheetWriterFactory) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	src, err := memoryExcelSource(data, opts.Password)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	/* Every sheet has its own writer, the name template is not used. */
+	opts.NameTemplate = ""
+	jobs, err := convertWorkbook(src, opts, write, func(job sheetJob, convert func(io.Writer) error) error {
+		w, err := create(job.sheet)
+		if err != nil {
+			return err
+		}
+		if err = convert(w); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	})
+	var sheets []string
+	for _, job := range jobs {
+		sheets = append(sheets, job.sheet)
+	}
+	return sheets, err
+}
+
+/* sheetJob is a selected sheet and its 1-based position in the workbook. */
+type sheetJob struct {
+	sheet string
+	index int
+}
+
+/* sheetEmitter hands the destination of the sheet to convert, which writes the rows to it. */
+type sheetEmitter func(job sheetJob, convert func(w io.Writer) error) error
+
+/*
+convertWorkbook converts every selected sheet of the workbook through emit and returns the converted sheets.
+A failed sheet doesn't stop the others, the failures are returned as SheetErrors.
+*/
+func convertWorkbook(src excelSource, opts ExcelOptions, write sheetWriter, emit sheetEmitter) ([]sheetJob, error) {
+	book, err := src(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer book.close()
+
+	var jobs []sheetJob
+	var errs SheetErrors
+	for i, sheetName := range book.sheets() {
+		ok, err := opts.selectSheet(book, sheetName)
+		if err != nil {
+			errs = append(errs, &SheetError{Sheet: sheetName, Err: wrapError(err)})
+			continue
+		}
+		if ok {
+			jobs = append(jobs, sheetJob{sheet: sheetName, index: i + 1})
+		}
+	}
+	if len(jobs) > 1 && opts.NameTemplate != "" &&
+		!strings.Contains(opts.NameTemplate, "{sheet}") && !strings.Contains(opts.NameTemplate, "{index}") {
+		return nil, wrapError(fmt.Errorf("name template %q needs {sheet} or {index} to write %d sheets", opts.NameTemplate, len(jobs)))
+	}
+
+	results := make([]error, len(jobs))
+	if opts.Workers <= 1 || len(jobs) <= 1 {
+		for i, job := range jobs {
+			results[i] = convertSheet(book, job, opts, write, emit)
+		}
+	} else {
+		convertSheetsConcurrently(src, jobs, results, opts, write, emit)
+	}
+
+	var done []sheetJob
+	for i, job := range jobs {
+		if results[i] != nil {
+			errs = append(errs, &SheetError{Sheet: job.sheet, Err: results[i]})
+			continue
+		}
+		done = append(done, job)
+	}
+	if len(errs) != 0 {
+		return done, errs
+	}
+	return done, nil
+}
+
+/*
+convertSheetsConcurrently converts the jobs with opts.Workers goroutines and stores the error of every job in results.
+Each worker opens its own handle of the workbook, excelize readers are not safe for concurrent use.
+*/
+func convertSheetsConcurrently(src excelSource, jobs []sheetJob, results []error, opts ExcelOptions, write sheetWriter, emit sheetEmitter) {
+	workers := opts.Workers
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			book, err := src(opts)
+			if err == nil {
+				defer book.close()
+			}
+			for i := range queue {
+				if err != nil {
+					results[i] = err
+					continue
+				}
+				results[i] = convertSheet(book, jobs[i], opts, write, emit)
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+}
+
+/* spreadsheet is an opened workbook the sheets are read from. */
+type spreadsheet interface {
+	sheets() []string
+	visible(sheet string) (bool, error)
+	rows(sheet string, opts ExcelOptions) (func() ([]string, error), func(), error)
+	close()
+}
+
+/* excelSource opens a handle of the workbook. */
+type excelSource func(opts ExcelOptions) (spreadsheet, error)
+
+/* oleSignature starts the compound file an encrypted workbook is stored in. */
+var oleSignature = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+/*
+fileExcelSource returns the excelSource of the workbook file, an OpenDocument spreadsheet is recognized by
+its .ods extension or its mimetype entry. An encrypted workbook is decrypted into memory with the password.
+*/
+func fileExcelSource(filePath, password string) (excelSource, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, odsHeadSize)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	if strings.EqualFold(filepath.Ext(filePath), ".ods") || isODS(head) {
+		return odsSource(func() (*zip.Reader, io.Closer, error) {
+			zr, err := zip.OpenReader(filePath)
+			if err != nil {
+				return nil, nil, err
+			}
+			return &zr.Reader, zr, nil
+		}), nil
+	}
+	if bytes.HasPrefix(head, oleSignature) {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		return memoryExcelSource(data, password)
+	}
+	return xlsxSource(
+		func() (*excelize.File, error) { return excelize.OpenFile(filePath) },
+		func() (*excelArchive, error) { return openExcelArchive(filePath) },
+	), nil
+}
+
+/* memoryExcelSource returns the excelSource of a workbook held in memory, decrypting it with the password when it is encrypted. */
+func memoryExcelSource(data []byte, password string) (excelSource, error) {
+	if isODS(data) {
+		return odsSource(func() (*zip.Reader, io.Closer, error) {
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			return zr, io.NopCloser(nil), err
+		}), nil
+	}
+	if bytes.HasPrefix(data, oleSignature) {
+		decrypted, err := decryptWorkbook(data, password)
+		if err != nil {
+			return nil, err
+		}
+		data = decrypted
+	}
+	return xlsxSource(
+		func() (*excelize.File, error) { return excelize.OpenReader(bytes.NewReader(data)) },
+		func() (*excelArchive, error) { return readExcelArchive(bytes.NewReader(data), int64(len(data))) },
+	), nil
+}
+
+/*
+ExcelPasswordError is returned for an encrypted workbook opened without a password (Missing) or with a wrong one,
+errors.Is matches it with excelize.ErrWorkbookPassword.
+*/
+type ExcelPasswordError struct {
+	Missing bool
+}
+
+func (e *ExcelPasswordError) Error() string {
+	if e.Missing {
+		return "the workbook is encrypted and no password was supplied"
+	}
+	return excelize.ErrWorkbookPassword.Error()
+}
+
+func (e *ExcelPasswordError) Unwrap() error {
+	return excelize.ErrWorkbookPassword
+}
+
+/*
+decryptWorkbook decrypts the compound file to the workbook package.
+A compound file that isn't an encrypted workbook, like a legacy .xls, returns excelize.ErrWorkbookFileFormat.
+*/
+func decryptWorkbook(data []byte, password string) ([]byte, error) {
+	decrypted, err := excelize.Decrypt(data, &excelize.Options{Password: password})
+	if err != nil {
+		return nil, excelize.ErrWorkbookFileFormat
+	}
+	if len(decrypted) == 0 {
+		return nil, excelize.ErrUnsupportedEncryptMechanism
+	}
+	if password == "" {
+		return nil, &ExcelPasswordError{Missing: true}
+	}
+	if _, err = zip.NewReader(bytes.NewReader(decrypted), int64(len(decrypted))); err != nil {
+		return nil, &ExcelPasswordError{}
+	}
+	return decrypted, nil
+}
+
+/* SheetError is the failure of converting a single sheet. */
+type SheetError struct {
+	Sheet string
+	Err   error
+}
+
+func (e *SheetError) Error() string {
+	return fmt.Sprintf("sheet %s: %v", e.Sheet, e.Err)
+}
+
+func (e *SheetError) Unwrap() error {
+	return e.Err
+}
+
+/* SheetErrors collects the failed sheets of a conversion in workbook order, the other sheets are still converted. */
+type SheetErrors []*SheetError
+
+func (e SheetErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e SheetErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, v := range e {
+		errs[i] = v
+	}
+	return errs
+}
+
+/* selectSheet reports whether the sheet passes the include, exclude and hidden filters. */
+func (opts ExcelOptions) selectSheet(book spreadsheet, sheetName string) (bool, error) {
+	if len(opts.IncludeSheets) != 0 || opts.IncludePattern != nil {
+		included := opts.IncludePattern != nil && opts.IncludePattern.MatchString(sheetName)
+		for _, v := range opts.IncludeSheets {
+			if v == sheetName {
+				included = true
+			}
+		}
+		if !included {
+			return false, nil
+		}
+	}
+	if opts.ExcludePattern != nil && opts.ExcludePattern.MatchString(sheetName) {
+		return false, nil
+	}
+	for _, v := range opts.ExcludeSheets {
+		if v == sheetName {
+			return false, nil
+		}
+	}
+	if opts.SkipHidden {
+		return book.visible(sheetName)
+	}
+	return true, nil
+}
+
+/* needsArchive reports whether the options need cell metadata the Rows iterator doesn't expose. */
+func (opts ExcelOptions) needsArchive() bool {
+	return opts.FillMerged || opts.FormulaText || opts.ISODates
+}
+
+/* delimiter returns Delimiter, or the character DelimiterName spells when it is set. */
+func (opts ExcelOptions) delimiter() (rune, error) {
+	if opts.DelimiterName == "" {
+		return opts.Delimiter, nil
+	}
+	return ParseDelimiter(opts.DelimiterName)
+}
+
+/* convertSheet streams the rows of the sheet to the destination emit gives, so only the current row is held in memory. */
+func convertSheet(book spreadsheet, job sheetJob, opts ExcelOptions, write sheetWriter, emit sheetEmitter) error {
+	next, closeRows, err := book.rows(job.sheet, opts)
+	if err != nil {
+		return wrapError(err)
+	}
+	defer closeRows()
+
+	return emit(job, func(w io.Writer) error {
+		buf := bufio.NewWriter(w)
+		if err := write(next, buf); err != nil {
+			return wrapError(err)
+		}
+		if err := buf.Flush(); err != nil {
+			return wrapError(err)
+		}
+		return nil
+	})
+}
+
+/* writePartFile lets convert write fileName.part and renames it to fileName on success, a failure leaves no partial output. */
+func writePartFile(fileName string, convert func(io.Writer) error) error {
+	partName := fileName + ".part"
+	f, err := os.Create(partName)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err := excelFile.Close(); err != nil {
+	defer os.Remove(partName)
+	defer f.Close()
+
+	if err = convert(f); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partName, fileName)
+}
+
+/*
+sheetRows returns a function reading the rows of the sheet through the Rows iterator until io.EOF,
+and a function releasing them. The archive is only used for the options needing cell metadata.
+*/
+func sheetRows(excelFile *excelize.File, archive *excelArchive, sheetName string, opts ExcelOptions) (func() ([]string, error), func(), error) {
+	rows, err := excelFile.Rows(sheetName)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cells *sheetCells
+	if opts.needsArchive() {
+		if cells, err = newSheetCells(excelFile, archive, sheetName, opts); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+	}
+	closeRows := func() {
+		if err := rows.Close(); err != nil {
 			printError(err)
 		}
-	}()
+		if cells != nil {
+			if err := cells.Close(); err != nil {
+				printError(err)
+			}
+		}
+	}
+
+	var n int
+	done := false
+	next := func() ([]string, error) {
+		var row []string
+		if !done && rows.Next() {
+			if row, err = rows.Columns(excelize.Options{RawCellValue: opts.RawCellValue}); err != nil {
+				return nil, err
+			}
+		} else {
+			if err = rows.Error(); err != nil {
+				return nil, err
+			}
+			done = true
+			if cells == nil || n >= cells.lastRow {
+				return nil, io.EOF
+			}
+		}
+		n++
+		if cells == nil {
+			return row, nil
+		}
+		return cells.apply(n, row)
+	}
+	return next, closeRows, nil
+}
 
-	for _, sheetName := range excelFile.GetSheetList() {
-		fileName := strings.Replace(filePath, filepath.Ext(filePath), "_"+sheetName+ext, 1)
-		csvFile, err := os.Create(fileName)
+/* writeDelimitedRows writes the rows to w by delimiter, trailing empty rows are dropped like GetRows does. */
+func writeDelimitedRows(next func() ([]string, error), w io.Writer, delimiter rune) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+	var blank int
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return err
 		}
-		writer := csv.NewWriter(csvFile)
-		writer.Comma = delimiter
-		rows, err := excelFile.GetRows(sheetName)
+		if len(row) == 0 {
+			blank++
+			continue
+		}
+		for ; blank > 0; blank-- {
+			if err = writer.Write(nil); err != nil {
+				return err
+			}
+		}
+		if err = writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+/* writeJSONLRows writes every non-empty row below the header row to w as a JSON object. */
+func writeJSONLRows(next func() ([]string, error), w io.Writer, opts JSONLOptions) error {
+	var (
+		keys   [][]byte
+		values []any
+		line   []byte
+	)
+	for n := 1; ; n++ {
+		row, err := next()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			return wrapError(err)
+			return err
 		}
-		for _, row := range rows {
-			if err = writer.Write(row); err != nil {
-				return wrapError(err)
+		if n < opts.HeaderRow {
+			continue
+		}
+		if n == opts.HeaderRow {
+			if keys, err = jsonKeys(columnNames(row)); err != nil {
+				return err
 			}
+			continue
 		}
-		writer.Flush()
-		csvFile.Close()
-		if err = writer.Error(); err != nil {
-			return wrapError(err)
+		if len(row) == 0 {
+			continue
+		}
+		for len(keys) < len(row) {
+			key, err := JSONMarshal(columnName("", len(keys)))
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		values = values[:0]
+		for i := range keys {
+			switch {
+			case i >= len(row) || row[i] == "":
+				values = append(values, nil)
+			case opts.CoerceTypes:
+				values = append(values, coerceValue(row[i]))
+			default:
+				values = append(values, row[i])
+			}
+		}
+		if line, err = appendJSONObject(line[:0], keys, values, !opts.EmptyAsNull); err != nil {
+			return err
+		}
+		if _, err = w.Write(append(line, '\n')); err != nil {
+			return err
 		}
 	}
-	return nil
+}
+
+/* columnNames names the header cells, blank cells get their column letter and duplicates a numeric suffix. */
+func columnNames(header []string) []string {
+	names := make([]string, len(header))
+	used := make(map[string]bool)
+	for i, name := range header {
+		name = columnName(name, i)
+		unique := name
+		for n := 2; used[unique]; n++ {
+			unique = name + "_" + strconv.Itoa(n)
+		}
+		used[unique] = true
+		names[i] = unique
+	}
+	return names
+}
+
+/* columnName returns the trimmed name, or the letter of the 0-based column i when it is blank. */
+func columnName(name string, i int) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+	name, _ = excelize.ColumnNumberToName(i + 1)
+	return name
+}
+
+/* coerceValue converts s to an int64, float64 or bool when it is one, otherwise returns s. */
+func coerceValue(s string) any {
+	for _, typ := range []string{ParquetInt64, ParquetDouble, ParquetBoolean} {
+		if v, err := parseParquetValue(s, typ); err == nil {
+			return v
+		}
+	}
+	return s
 }
 
 /* ConvertExcelToCSV converts the Excel file to the CSV format file. */
@@ -68,6 +718,258 @@ func ConvertExcelToTSV(filePath string) error {
 	return ConvertExcel(filePath, ".tsv", '\t')
 }
 
+/* ConvertCSVToExcel converts the CSV files to the Excel file, each CSV file becomes a sheet. */
+func ConvertCSVToExcel(dstFile string, srcFiles ...string) error {
+	return ConvertTextToExcel(dstFile, ',', srcFiles...)
+}
+
+/* ConvertTSVToExcel converts the TSV files to the Excel file, each TSV file becomes a sheet. */
+func ConvertTSVToExcel(dstFile string, srcFiles ...string) error {
+	return ConvertTextToExcel(dstFile, '\t', srcFiles...)
+}
+
+/*
+ConvertTextToExcel converts the delimited text files to the Excel file through the StreamWriter,
+each source file becomes a sheet named after it. If delimiter is 0, it is chosen by the file extension.
+Numbers and dates are written as typed cells, the header row is frozen and columns are sized to fit.
+*/
+func ConvertTextToExcel(dstFile string, delimiter rune, srcFiles ...string) error {
+	excelFile := excelize.NewFile()
+	defer func() {
+		if err := excelFile.Close(); err != nil {
+			printError(err)
+		}
+	}()
+	dateStyle, err := excelFile.NewStyle(&excelize.Style{CustomNumFmt: &excelDateFormat})
+	if err != nil {
+		return wrapError(err)
+	}
+	timeStyle, err := excelFile.NewStyle(&excelize.Style{CustomNumFmt: &excelTimeFormat})
+	if err != nil {
+		return wrapError(err)
+	}
+
+	used := make(map[string]bool)
+	for i, srcFile := range srcFiles {
+		comma := delimiter
+		if comma == 0 {
+			comma = delimiterByExt(srcFile)
+		}
+		sheetName := excelSheetName(strings.TrimSuffix(filepath.Base(srcFile), filepath.Ext(srcFile)), used)
+		if i == 0 {
+			err = excelFile.SetSheetName(excelFile.GetSheetName(0), sheetName)
+		} else {
+			_, err = excelFile.NewSheet(sheetName)
+		}
+		if err != nil {
+			return wrapError(err)
+		}
+		widths, err := textColumnWidths(srcFile, comma)
+		if err != nil {
+			return err
+		}
+		if err = writeTextSheet(excelFile, sheetName, srcFile, comma, widths, dateStyle, timeStyle); err != nil {
+			return err
+		}
+	}
+	if err = excelFile.SaveAs(dstFile); err != nil {
+		return wrapError(err)
+	}
+	return nil
+}
+
+var (
+	excelDateFormat = "yyyy-mm-dd"
+	excelTimeFormat = "yyyy-mm-dd hh:mm:ss"
+)
+
+/* delimiterByExt returns the tab for .tsv and .tab files, otherwise the comma. */
+func delimiterByExt(filePath string) rune {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".tsv", ".tab":
+		return '\t'
+	}
+	return ','
+}
+
+/* excelSheetName makes name a valid and unique sheet name, used holds the names already taken. */
+func excelSheetName(name string, used map[string]bool) string {
+	name = strings.Trim(strings.Map(func(r rune) rune {
+		if strings.ContainsRune(":\\/?*[]", r) {
+			return '_'
+		}
+		return r
+	}, name), "'")
+	if name == "" {
+		name = "Sheet"
+	}
+	unique := truncateRunes(name, excelize.MaxSheetNameLength)
+	for i := 2; used[strings.ToLower(unique)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		unique = truncateRunes(name, excelize.MaxSheetNameLength-len(suffix)) + suffix
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+/* truncateRunes returns the first n runes of s. */
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+/* newTextReader returns a csv.Reader that accepts a variable number of fields per record. */
+func newTextReader(r io.Reader, delimiter rune) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return reader
+}
+
+/* textColumnWidths scans the delimited file and returns the display width of every column. */
+func textColumnWidths(srcFile string, delimiter rune) ([]float64, error) {
+	f, err := os.Open(srcFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var widths []float64
+	reader := newTextReader(f, delimiter)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return widths, nil
+		}
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		for i, field := range record {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			w := float64(utf8.RuneCountInString(field)) + 2
+			if w > widths[i] {
+				widths[i] = math.Min(w, 100)
+			}
+		}
+	}
+}
+
+/* writeTextSheet streams the delimited file into the sheet, the first row is kept as text. */
+func writeTextSheet(excelFile *excelize.File, sheetName, srcFile string, delimiter rune, widths []float64, dateStyle, timeStyle int) error {
+	f, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sw, err := excelFile.NewStreamWriter(sheetName)
+	if err != nil {
+		return wrapError(err)
+	}
+	for i, w := range widths {
+		if err = sw.SetColWidth(i+1, i+1, w); err != nil {
+			return wrapError(err)
+		}
+	}
+	err = sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	if err != nil {
+		return wrapError(err)
+	}
+
+	reader := newTextReader(f, delimiter)
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return wrapError(err)
+		}
+		values := make([]any, len(record))
+		for i, field := range record {
+			if row == 1 {
+				values[i] = field
+				continue
+			}
+			values[i] = inferCellValue(field, dateStyle, timeStyle)
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		if err = sw.SetRow(cell, values); err != nil {
+			return wrapError(err)
+		}
+	}
+	if err = sw.Flush(); err != nil {
+		return wrapError(err)
+	}
+	return nil
+}
+
+/* excelDateLayouts are the layouts recognized as dates, the first two hold no time of day. */
+var excelDateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"2006-01-02 15:04:05",
+	"2006/01/02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	time.RFC3339Nano,
+}
+
+/*
+inferCellValue converts the field to int64, float64 or a styled time.Time cell when possible.
+Numbers with leading zeros or more than 15 digits stay text, Excel would lose them.
+*/
+func inferCellValue(field string, dateStyle, timeStyle int) any {
+	if field == "" {
+		return nil
+	}
+	if isNumberLike(field) {
+		if v, err := strconv.ParseInt(field, 10, 64); err == nil {
+			return v
+		}
+		if v, err := strconv.ParseFloat(field, 64); err == nil {
+			return v
+		}
+	}
+	for i, layout := range excelDateLayouts {
+		if t, err := time.Parse(layout, field); err == nil {
+			if i < 2 {
+				return excelize.Cell{StyleID: dateStyle, Value: t}
+			}
+			return excelize.Cell{StyleID: timeStyle, Value: t}
+		}
+	}
+	return field
+}
+
+/* isNumberLike reports whether s is a plain decimal number that round-trips through a float64. */
+func isNumberLike(s string) bool {
+	digits := strings.TrimLeft(s, "+-")
+	if digits == "" || len(s)-len(digits) > 1 {
+		return false
+	}
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return false
+	}
+	var n int
+	for i, c := range digits {
+		switch {
+		case c >= '0' && c <= '9':
+			n++
+		case c == '.' || (i > 0 && (c == 'e' || c == 'E')):
+		case (c == '+' || c == '-') && i > 0 && (digits[i-1] == 'e' || digits[i-1] == 'E'):
+		default:
+			return false
+		}
+	}
+	return n > 0 && n <= 15
+}
+
 /* ConvertStringToCharByte converts the given string(char) to a byte slice, if error returns nil. */
 func ConvertStringToCharByte(s string) ([]byte, error) {
 	r, err := ConvertStringToCharRune(s)
@@ -79,13 +981,58 @@ func ConvertStringToCharByte(s string) ([]byte, error) {
 	return b, nil
 }
 
-/* ConvertStringToCharRune converts the given string(char) to rune, if error returns 0 and error. */
+/* ConvertStringToCharRune converts the given string(char) to rune like ParseDelimiter, if error returns 0 and error. */
 func ConvertStringToCharRune(s string) (rune, error) {
-	r, _, _, err := strconv.UnquoteChar(s, '\'')
-	if err != nil {
-		return 0, wrapError(err)
+	return ParseDelimiter(s)
+}
+
+/* delimiterNames are the names ParseDelimiter accepts, the ASCII control names included. */
+var delimiterNames = map[string]rune{
+	"comma": ',', "tab": '\t', "pipe": '|', "bar": '|', "semicolon": ';', "colon": ':', "space": ' ',
+	"nul": 0x00, "soh": 0x01, "stx": 0x02, "etx": 0x03, "eot": 0x04, "enq": 0x05, "ack": 0x06, "bel": 0x07,
+	"bs": 0x08, "ht": 0x09, "lf": 0x0a, "vt": 0x0b, "ff": 0x0c, "cr": 0x0d, "so": 0x0e, "si": 0x0f,
+	"dle": 0x10, "dc1": 0x11, "dc2": 0x12, "dc3": 0x13, "dc4": 0x14, "nak": 0x15, "syn": 0x16, "etb": 0x17,
+	"can": 0x18, "em": 0x19, "sub": 0x1a, "esc": 0x1b, "fs": 0x1c, "gs": 0x1d, "rs": 0x1e, "us": 0x1f, "del": 0x7f,
+}
+
+/*
+ParseDelimiter returns the single character s spells: the character itself, a Go escape like "\t" or "\x1f",
+a name like "tab", "pipe" or the ASCII "US" in any case, a code point like "0x1F" or "U+001F",
+or a caret notation like "^A". Anything else is an error.
+*/
+func ParseDelimiter(s string) (rune, error) {
+	if utf8.RuneCountInString(s) == 1 {
+		r, _ := utf8.DecodeRuneInString(s)
+		return r, nil
+	}
+	if r, ok := delimiterNames[strings.ToLower(s)]; ok {
+		return r, nil
+	}
+	if strings.HasPrefix(s, "\\") {
+		if r, _, tail, err := strconv.UnquoteChar(s, '\''); err == nil && tail == "" {
+			return r, nil
+		}
+	}
+	for _, prefix := range []string{"0x", "0X", "U+", "u+"} {
+		if hex, ok := strings.CutPrefix(s, prefix); ok {
+			if code, err := strconv.ParseUint(hex, 16, 32); err == nil && utf8.ValidRune(rune(code)) {
+				return rune(code), nil
+			}
+		}
 	}
-	return r, nil
+	if len(s) == 2 && s[0] == '^' {
+		c := s[1]
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		switch {
+		case c == '?':
+			return 0x7f, nil
+		case c >= '@' && c <= '_':
+			return rune(c - '@'), nil
+		}
+	}
+	return 0, wrapError(fmt.Errorf("delimiter %q is not a single character", s))
 }
 
 /* JSONMarshal returns the JSON encoding bytes of v. */
@@ -108,6 +1055,43 @@ func JSONUnmarshalString(data string, v any) error {
 	return sonic.UnmarshalString(data, v)
 }
 
+/* jsonKeys returns the JSON encoding of every name. */
+func jsonKeys(names []string) ([][]byte, error) {
+	keys := make([][]byte, len(names))
+	for i, name := range names {
+		key, err := JSONMarshal(name)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+/*
+appendJSONObject appends the JSON object of keys and values to dst keeping the key order,
+nil values are left out when omitNil is set.
+*/
+func appendJSONObject(dst []byte, keys [][]byte, values []any, omitNil bool) ([]byte, error) {
+	dst = append(dst, '{')
+	first := true
+	for i, v := range values {
+		if v == nil && omitNil {
+			continue
+		}
+		data, err := JSONMarshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if !first {
+			dst = append(dst, ',')
+		}
+		first = false
+		dst = append(append(append(dst, keys[i]...), ':'), data...)
+	}
+	return append(dst, '}'), nil
+}
+
 /*
 ParquetWriter creates the file and a ParquetWriter capable of writing data in parquet format,
 obj is a object with tags or JSON schema string.
@@ -121,35 +1105,40 @@ func ParquetWriter(dstFile string, obj any) (source.ParquetFile, *writer.Parquet
 	if err != nil {
 		return nil, nil, fmt.Errorf("parquet handler: %w", err)
 	}
-	pw.RowGroupSize = 128 * 1024 * 1024 //128M
-	pw.PageSize = 8 * 1024              //8K
-	pw.CompressionType = parquet.CompressionCodec_ZSTD
+	setParquetWriter(pw)
 	return fw, pw, nil
 }
 
-/* RemoveNullByteInFile removes the ASCII 0 in the file. */
-func RemoveNullByteInFile(filePath string) error {
-	stat, err := os.Stat(filePath)
+/* parquetWriterTo returns a ParquetWriter like ParquetWriter writing to w. */
+func parquetWriterTo(w io.Writer, obj any) (*writer.ParquetWriter, error) {
+	pw, err := writer.NewParquetWriterFromWriter(w, obj, 4)
 	if err != nil {
-		return wrapError(err)
+		return nil, fmt.Errorf("parquet handler: %w", err)
 	}
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return wrapError(err)
-	}
-	b := RemoveNullByte(data)
-	return os.WriteFile(filePath, b, stat.Mode())
+	setParquetWriter(pw)
+	return pw, nil
+}
+
+/* setParquetWriter sets the row group size, the page size and the compression of the files written. */
+func setParquetWriter(pw *writer.ParquetWriter) {
+	pw.RowGroupSize = 128 * 1024 * 1024 //128M
+	pw.PageSize = 8 * 1024              //8K
+	pw.CompressionType = parquet.CompressionCodec_ZSTD
+}
+
+/* RemoveNullByteInFile removes the ASCII 0 in the file, the file is streamed and rewritten as opts say. */
+func RemoveNullByteInFile(filePath string, opts ...RewriteOptions) error {
+	return RewriteFile(filePath, rewriteOptions(opts), func(r io.Reader, w io.Writer) error {
+		if _, err := io.Copy(w, NewByteFilterReader(r)); err != nil {
+			return wrapError(err)
+		}
+		return nil
+	})
 }
 
-/* RemoveNullByteInReader removes the ASCII 0 in reader. */
+/* RemoveNullByteInReader returns a reader dropping the ASCII 0 of reader as it is read. */
 func RemoveNullByteInReader(reader io.Reader) (io.Reader, error) {
-	r, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, wrapError(err)
-	}
-	b := RemoveNullByte(r)
-	buf := bytes.NewBuffer(b)
-	return buf, nil
+	return NewByteFilterReader(reader), nil
 }
 
 /* RemoveNullByte removes the ASCII 0 in the data. */
@@ -157,36 +1146,150 @@ func RemoveNullByte(data []byte) []byte {
 	return bytes.ReplaceAll(data, []byte{0}, []byte{})
 }
 
-/* ReplaceDelimiter replaces the old delimiter with the new delimiter in the filePath. */
+/*
+ReplaceDelimiter replaces the old delimiter with the new delimiter in the filePath, both are read like
+ReplaceDelimiterWithOptions reads them. The old delimiter used to be a regular expression, so one escaping
+a regular expression metacharacter like \| is still matched as a regular expression.
+*/
 func ReplaceDelimiter(filePath string, old, new string) error {
-	f, err := os.ReadFile(filePath)
-	if err != nil {
-		return wrapError(err)
+	return ReplaceDelimiterWithOptions(filePath, old, new, DelimiterOptions{Regexp: isEscapedPattern(old)})
+}
+
+/* isEscapedPattern reports whether s is a valid regular expression escaping a metacharacter with a backslash. */
+func isEscapedPattern(s string) bool {
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] != '\\' {
+			continue
+		}
+		if strings.IndexByte(`\.+*?()|[]{}^$`, s[i+1]) >= 0 {
+			_, err := regexp.Compile(s)
+			return err == nil
+		}
+		i++
 	}
-	stat, err := os.Stat(filePath)
+	return false
+}
+
+/*
+DelimiterOptions configures ReplaceDelimiterWithOptions.
+
+Old is a literal string, escapes like \t included, unless Regexp is set, either is matched within each line.
+New is read by ParseDelimiter.
+CSV parses the quoted fields, which may hold the old delimiter, and quotes the fields holding the new one,
+both delimiters must then be single characters and blank lines are dropped like encoding/csv does.
+Rewrite asks ReplaceDelimiterWithOptions for a backup or the kept modification time of the file.
+*/
+type DelimiterOptions struct {
+	Regexp  bool
+	CSV     bool
+	Rewrite RewriteOptions
+}
+
+/* ReplaceDelimiterWithOptions replaces the old delimiter with the new delimiter in the filePath, the file is streamed. */
+func ReplaceDelimiterWithOptions(filePath, old, new string, opts DelimiterOptions) error {
+	return RewriteFile(filePath, opts.Rewrite, func(r io.Reader, w io.Writer) error {
+		return ReplaceDelimiterStream(w, r, old, new, opts)
+	})
+}
+
+/* ReplaceDelimiterStream copies src to dst replacing the old delimiter with the new delimiter. */
+func ReplaceDelimiterStream(dst io.Writer, src io.Reader, old, new string, opts DelimiterOptions) error {
+	newBytes, err := ConvertStringToCharByte(new)
 	if err != nil {
 		return wrapError(err)
 	}
-	b, err := ConvertStringToCharByte(new)
-	if err != nil {
+	if opts.CSV {
+		return replaceCSVDelimiter(dst, src, old, []rune(string(newBytes))[0])
+	}
+
+	var replace func([]byte) []byte
+	if opts.Regexp {
+		re, err := regexp.Compile(old)
+		if err != nil {
+			return wrapError(err)
+		}
+		replace = func(line []byte) []byte {
+			return re.ReplaceAllLiteral(line, newBytes)
+		}
+	} else {
+		oldBytes := delimiterBytes(old)
+		if len(oldBytes) == 0 {
+			return wrapError(errors.New("empty delimiter"))
+		}
+		replace = func(line []byte) []byte {
+			return bytes.ReplaceAll(line, oldBytes, newBytes)
+		}
+	}
+
+	reader := bufio.NewReader(src)
+	writer := bufio.NewWriter(dst)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) != 0 {
+			if _, err := writer.Write(replace(line)); err != nil {
+				return wrapError(err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return wrapError(err)
+		}
+	}
+	if err = writer.Flush(); err != nil {
 		return wrapError(err)
 	}
-	eol := regexp.MustCompile(old)
-	f = eol.ReplaceAllLiteral(f, b)
-	return os.WriteFile(filePath, f, stat.Mode())
+	return nil
 }
 
-/* ReplaceDosToUnix replaces the Windows end of line(eol) with the Unix eol in the filePath. */
-func ReplaceDosToUnix(filePath string) error {
-	f, err := os.ReadFile(filePath)
+/* replaceCSVDelimiter re-emits the records of src with the new delimiter, keeping CRLF line endings. */
+func replaceCSVDelimiter(dst io.Writer, src io.Reader, old string, new rune) error {
+	comma, err := ParseDelimiter(old)
 	if err != nil {
+		return wrapError(fmt.Errorf("csv delimiter %q is not a single character", old))
+	}
+	reader := bufio.NewReader(src)
+	head, _ := reader.Peek(reader.Size())
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = comma
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+	csvReader.ReuseRecord = true
+
+	buf := bufio.NewWriter(dst)
+	writer := csv.NewWriter(buf)
+	writer.Comma = new
+	writer.UseCRLF = sniffLineEnding(head) == LineEndingCRLF
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return wrapError(err)
+		}
+		if err = writer.Write(record); err != nil {
+			return wrapError(err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
 		return wrapError(err)
 	}
-	stat, err := os.Stat(filePath)
-	if err != nil {
+	if err := buf.Flush(); err != nil {
 		return wrapError(err)
 	}
-	eol := regexp.MustCompile(`\r\n`)
-	f = eol.ReplaceAllLiteral(f, []byte{'\n'})
-	return os.WriteFile(filePath, f, stat.Mode())
+	return nil
+}
+
+/*
+delimiterBytes returns the literal delimiter s with its Go escapes like \t resolved.
+Names like "tab" are not read, a literal string may be one, ParseDelimiter reads single characters.
+*/
+func delimiterBytes(s string) []byte {
+	if u, err := strconv.Unquote(`"` + s + `"`); err == nil {
+		return []byte(u)
+	}
+	return []byte(s)
 }
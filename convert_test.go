@@ -1,11 +1,19 @@
 package utils
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -64,6 +72,494 @@ func TestConvertExcel(t *testing.T) {
 	requirement.Nil(os.RemoveAll(testDir))
 }
 
+func TestConvertExcelWithOptions(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "report.xlsx")
+	f := excelize.NewFile()
+	for _, name := range []string{"Data", "Hidden", "Notes"} {
+		_, err := f.NewSheet(name)
+		requirement.Nil(err)
+		requirement.Nil(f.SetCellStr(name, "A1", name))
+	}
+	requirement.Nil(f.DeleteSheet("Sheet1"))
+	requirement.Nil(f.SetSheetVisible("Hidden", false))
+	style, err := f.NewStyle(&excelize.Style{NumFmt: 10})
+	requirement.Nil(err)
+	requirement.Nil(f.SetCellFloat("Data", "B1", 0.5, -1, 64))
+	requirement.Nil(f.SetCellStyle("Data", "B1", "B1", style))
+	requirement.Nil(f.SaveAs(srcFile))
+	requirement.Nil(f.Close())
+	outDir := filepath.Join(testDir, "out")
+	createDir(outDir)
+
+	testCases := []struct {
+		name     string
+		opts     ExcelOptions
+		expected map[string]string
+	}{
+		{
+			name: "All",
+			opts: ExcelOptions{},
+			expected: map[string]string{
+				"report_Data.csv":   "Data,50.00%\n",
+				"report_Hidden.csv": "Hidden\n",
+				"report_Notes.csv":  "Notes\n",
+			},
+		},
+		{
+			name: "SkipHidden",
+			opts: ExcelOptions{SkipHidden: true, ExcludeSheets: []string{"Notes"}, RawCellValue: true},
+			expected: map[string]string{
+				"report_Data.csv": "Data,0.5\n",
+			},
+		},
+		{
+			name: "Pattern",
+			opts: ExcelOptions{
+				Ext:            ".tsv",
+				Delimiter:      '\t',
+				IncludePattern: regexp.MustCompile(`^(Data|Notes)$`),
+				ExcludePattern: regexp.MustCompile(`^D`),
+				OutputDir:      outDir,
+				NameTemplate:   "{index}-{sheet}{ext}",
+			},
+			expected: map[string]string{
+				filepath.Join("out", "3-Notes.tsv"): "Notes\n",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(*testing.T) {
+			files, err := ConvertExcelWithOptions(srcFile, testCase.opts)
+			requirement.Nil(err)
+			assertion.Len(files, len(testCase.expected))
+			for name, expected := range testCase.expected {
+				file := filepath.Join(testDir, name)
+				assertion.Contains(files, file)
+				got, err := os.ReadFile(file)
+				requirement.Nil(err)
+				assertion.Equal(expected, string(got))
+				requirement.Nil(os.Remove(file))
+			}
+		})
+	}
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestConvertExcelWorkers(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "book.xlsx")
+	f := excelize.NewFile()
+	var sheets []string
+	for i := 1; i <= 12; i++ {
+		name := "S" + strconv.Itoa(i)
+		sheets = append(sheets, name)
+		_, err := f.NewSheet(name)
+		requirement.Nil(err)
+		for r := 1; r <= 50; r++ {
+			requirement.Nil(f.SetSheetRow(name, "A"+strconv.Itoa(r), &[]any{name, r, "a,b"}))
+		}
+	}
+	requirement.Nil(f.DeleteSheet("Sheet1"))
+	requirement.Nil(f.SaveAs(srcFile))
+	requirement.Nil(f.Close())
+
+	seqDir := filepath.Join(testDir, "seq")
+	parDir := filepath.Join(testDir, "par")
+	createDir(seqDir)
+	createDir(parDir)
+	/* A non-empty directory in place of the output file makes that sheet fail. */
+	createDir(filepath.Join(seqDir, "book_S5.csv", "x"))
+	createDir(filepath.Join(parDir, "book_S5.csv", "x"))
+
+	seqFiles, seqErr := ConvertExcelWithOptions(srcFile, ExcelOptions{OutputDir: seqDir, FillMerged: true})
+	parFiles, parErr := ConvertExcelWithOptions(srcFile, ExcelOptions{OutputDir: parDir, FillMerged: true, Workers: 4})
+	for _, err := range []error{seqErr, parErr} {
+		var errs SheetErrors
+		requirement.ErrorAs(err, &errs)
+		requirement.Len(errs, 1)
+		assertion.Equal("S5", errs[0].Sheet)
+	}
+	requirement.Len(parFiles, len(sheets)-1)
+	for i, file := range parFiles {
+		assertion.Equal(filepath.Base(seqFiles[i]), filepath.Base(file))
+		expected, err := os.ReadFile(seqFiles[i])
+		requirement.Nil(err)
+		got, err := os.ReadFile(file)
+		requirement.Nil(err)
+		assertion.Equal(string(expected), string(got))
+	}
+	partFiles, err := filepath.Glob(filepath.Join(parDir, "*.part"))
+	requirement.Nil(err)
+	assertion.Empty(partFiles)
+
+	for _, workers := range []int{0, 4} {
+		_, err = ConvertExcelWithOptions(srcFile, ExcelOptions{OutputDir: parDir, NameTemplate: "all{ext}", Workers: workers})
+		assertion.ErrorContains(err, "needs {sheet} or {index} to write 12 sheets")
+		assertion.NoFileExists(filepath.Join(parDir, "all.csv"))
+	}
+	files, err := ConvertExcelWithOptions(srcFile, ExcelOptions{OutputDir: parDir, NameTemplate: "all{ext}", IncludeSheets: []string{"S2"}})
+	requirement.Nil(err)
+	assertion.Equal([]string{filepath.Join(parDir, "all.csv")}, files)
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+type sheetBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *sheetBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestConvertExcelReader(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	f := excelize.NewFile()
+	requirement.Nil(f.SetSheetRow("Sheet1", "A1", &[]any{"id", "name"}))
+	requirement.Nil(f.SetSheetRow("Sheet1", "A2", &[]any{1, "merged"}))
+	requirement.Nil(f.MergeCell("Sheet1", "B2", "B3"))
+	requirement.Nil(f.SetSheetRow("Sheet1", "A3", &[]any{2}))
+	_, err := f.NewSheet("Broken")
+	requirement.Nil(err)
+	data, err := f.WriteToBuffer()
+	requirement.Nil(err)
+	requirement.Nil(f.Close())
+
+	var mu sync.Mutex
+	buffers := make(map[string]*sheetBuffer)
+	create := func(sheet string) (io.WriteCloser, error) {
+		if sheet == "Broken" {
+			return nil, errors.New("no destination")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		buffers[sheet] = new(sheetBuffer)
+		return buffers[sheet], nil
+	}
+
+	sheets, err := ConvertExcelReader(bytes.NewReader(data.Bytes()), ExcelOptions{FillMerged: true, Workers: 2}, create)
+	var errs SheetErrors
+	requirement.ErrorAs(err, &errs)
+	assertion.Equal("Broken", errs[0].Sheet)
+	assertion.Equal([]string{"Sheet1"}, sheets)
+	assertion.True(buffers["Sheet1"].closed)
+	assertion.Equal("id,name\n1,merged\n2,merged\n", buffers["Sheet1"].String())
+
+	sheets, err = ConvertExcelReaderToJSONL(bytes.NewReader(data.Bytes()), JSONLOptions{ExcelOptions: ExcelOptions{IncludeSheets: []string{"Sheet1"}}}, create)
+	requirement.Nil(err)
+	assertion.Equal([]string{"Sheet1"}, sheets)
+	assertion.Equal(`{"id":"1","name":"merged"}`+"\n"+`{"id":"2"}`+"\n", buffers["Sheet1"].String())
+
+	opts := ExcelOptions{IncludeSheets: []string{"Sheet1"}, Delimiter: ';', DelimiterName: "US"}
+	_, err = ConvertExcelReader(bytes.NewReader(data.Bytes()), opts, create)
+	requirement.Nil(err)
+	assertion.Equal("id\x1fname\n1\x1fmerged\n2\n", buffers["Sheet1"].String())
+	opts.DelimiterName = "unit separator"
+	_, err = ConvertExcelReader(bytes.NewReader(data.Bytes()), opts, create)
+	assertion.ErrorContains(err, "not a single character")
+}
+
+func TestConvertExcelPassword(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "secret.xlsx")
+	f := excelize.NewFile()
+	requirement.Nil(f.SetSheetRow("Sheet1", "A1", &[]any{"id", "amount"}))
+	requirement.Nil(f.SetSheetRow("Sheet1", "A2", &[]any{1, 9.5}))
+	requirement.Nil(f.SaveAs(srcFile, excelize.Options{Password: "s3cret"}))
+	requirement.Nil(f.Close())
+	corruptFile := filepath.Join(testDir, "corrupt.xlsx")
+	requirement.Nil(os.WriteFile(corruptFile, []byte("not a workbook"), os.ModePerm))
+
+	testCases := []struct {
+		name     string
+		file     string
+		password string
+		missing  bool
+		wrong    bool
+	}{
+		{name: "Correct", file: srcFile, password: "s3cret"},
+		{name: "Missing", file: srcFile, missing: true},
+		{name: "Wrong", file: srcFile, password: "guess", wrong: true},
+		{name: "Corrupt", file: corruptFile, password: "s3cret"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(*testing.T) {
+			files, err := ConvertExcelWithOptions(testCase.file, ExcelOptions{Password: testCase.password, FillMerged: true, Workers: 2})
+			var passwordErr *ExcelPasswordError
+			switch {
+			case testCase.missing || testCase.wrong:
+				requirement.ErrorAs(err, &passwordErr)
+				assertion.Equal(testCase.missing, passwordErr.Missing)
+				assertion.ErrorIs(err, excelize.ErrWorkbookPassword)
+			case testCase.file == corruptFile:
+				requirement.Error(err)
+				assertion.False(errors.As(err, &passwordErr))
+			default:
+				requirement.Nil(err)
+				requirement.Len(files, 1)
+				got, err := os.ReadFile(files[0])
+				requirement.Nil(err)
+				assertion.Equal("id,amount\n1,9.5\n", string(got))
+			}
+		})
+	}
+
+	data, err := os.ReadFile(srcFile)
+	requirement.Nil(err)
+	buf := new(sheetBuffer)
+	_, err = ConvertExcelReader(bytes.NewReader(data), ExcelOptions{Password: "s3cret"}, func(string) (io.WriteCloser, error) {
+		return buf, nil
+	})
+	requirement.Nil(err)
+	assertion.Equal("id,amount\n1,9.5\n", buf.String())
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestConvertExcelToJSONL(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "api.xlsx")
+	f := excelize.NewFile()
+	sheetName := "Sheet1"
+	requirement.Nil(f.SetSheetRow(sheetName, "A1", &[]any{"exported 2023-07-01"}))
+	requirement.Nil(f.SetSheetRow(sheetName, "A2", &[]any{"id", "name", "", "name", "ok"}))
+	requirement.Nil(f.SetSheetRow(sheetName, "A3", &[]any{1, "a\"b", 2.5, "x", true}))
+	requirement.Nil(f.SetSheetRow(sheetName, "A5", &[]any{"007", nil, nil, nil, "no", "extra"}))
+	requirement.Nil(f.SaveAs(srcFile))
+	requirement.Nil(f.Close())
+
+	testCases := []struct {
+		name     string
+		opts     JSONLOptions
+		expected string
+	}{
+		{
+			name: "Default",
+			opts: JSONLOptions{},
+			expected: `{"exported 2023-07-01":"id","B":"name","D":"name","E":"ok"}` + "\n" +
+				`{"exported 2023-07-01":"1","B":"a\"b","C":"2.5","D":"x","E":"TRUE"}` + "\n" +
+				`{"exported 2023-07-01":"007","E":"no","F":"extra"}` + "\n",
+		},
+		{
+			name: "HeaderRow",
+			opts: JSONLOptions{HeaderRow: 2},
+			expected: `{"id":"1","name":"a\"b","C":"2.5","name_2":"x","ok":"TRUE"}` + "\n" +
+				`{"id":"007","ok":"no","F":"extra"}` + "\n",
+		},
+		{
+			name: "Coerce",
+			opts: JSONLOptions{HeaderRow: 2, EmptyAsNull: true, CoerceTypes: true},
+			expected: `{"id":1,"name":"a\"b","C":2.5,"name_2":"x","ok":true}` + "\n" +
+				`{"id":"007","name":null,"C":null,"name_2":null,"ok":"no","F":"extra"}` + "\n",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(*testing.T) {
+			files, err := ConvertExcelToJSONL(srcFile, testCase.opts)
+			requirement.Nil(err)
+			requirement.Equal([]string{filepath.Join(testDir, "api_Sheet1.jsonl")}, files)
+			got, err := os.ReadFile(files[0])
+			requirement.Nil(err)
+			assertion.Equal(testCase.expected, string(got))
+		})
+	}
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestConvertExcelCells(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "cells.xlsx")
+	f := excelize.NewFile()
+	sheetName := "Sheet1"
+	requirement.Nil(f.SetCellStr(sheetName, "A1", "Region"))
+	requirement.Nil(f.MergeCell(sheetName, "A1", "B2"))
+	requirement.Nil(f.SetCellStr(sheetName, "D4", "Total"))
+	requirement.Nil(f.MergeCell(sheetName, "D4", "D5"))
+	dateStyle, err := f.NewStyle(&excelize.Style{NumFmt: 14})
+	requirement.Nil(err)
+	customFmt := "[$-409]yyyy/mm/dd hh:mm;@"
+	timeStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &customFmt})
+	requirement.Nil(err)
+	requirement.Nil(f.SetCellValue(sheetName, "C1", time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)))
+	requirement.Nil(f.SetCellStyle(sheetName, "C1", "C1", dateStyle))
+	requirement.Nil(f.SetCellValue(sheetName, "C2", time.Date(2023, 7, 1, 8, 30, 0, 0, time.UTC)))
+	requirement.Nil(f.SetCellStyle(sheetName, "C2", "C2", timeStyle))
+	requirement.Nil(f.SetCellInt(sheetName, "A3", 1))
+	requirement.Nil(f.SetCellInt(sheetName, "A4", 2))
+	ref, shared := "B3:B4", excelize.STCellFormulaTypeShared
+	requirement.Nil(f.SetCellFormula(sheetName, "B3", "A3*2+$A$3", excelize.FormulaOpts{Ref: &ref, Type: &shared}))
+	requirement.Nil(f.SetCellFormula(sheetName, "C3", `CONCAT("A1",A3)`))
+	requirement.Nil(f.SaveAs(srcFile))
+	requirement.Nil(f.Close())
+
+	testCases := []struct {
+		name     string
+		opts     ExcelOptions
+		expected string
+	}{
+		{
+			name:     "Default",
+			opts:     ExcelOptions{},
+			expected: "Region,,07-01-23\n,,2023/07/01 08:30\n1,,\n2,,,Total\n",
+		},
+		{
+			name: "All",
+			opts: ExcelOptions{FillMerged: true, FormulaText: true, ISODates: true},
+			expected: "Region,Region,2023-07-01\nRegion,Region,2023-07-01T08:30:00\n" +
+				"1,=A3*2+$A$3,\"=CONCAT(\"\"A1\"\",A3)\"\n2,=A4*2+$A$3,,Total\n,,,Total\n",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(*testing.T) {
+			files, err := ConvertExcelWithOptions(srcFile, testCase.opts)
+			requirement.Nil(err)
+			got, err := os.ReadFile(files[0])
+			requirement.Nil(err)
+			assertion.Equal(testCase.expected, string(got))
+		})
+	}
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestConvertExcelBlankRows(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "blank.xlsx")
+	f := excelize.NewFile()
+	sheetName := "Sheet1"
+	requirement.Nil(f.SetCellStr(sheetName, "A1", "head"))
+	requirement.Nil(f.SetCellStr(sheetName, "B4", "tail"))
+	requirement.Nil(f.SetCellStyle(sheetName, "A6", "A6", 0))
+	requirement.Nil(f.SaveAs(srcFile))
+	requirement.Nil(f.Close())
+
+	requirement.Nil(ConvertExcelToCSV(srcFile))
+	got, err := os.ReadFile(filepath.Join(testDir, "blank_"+sheetName+".csv"))
+	requirement.Nil(err)
+	assertion.Equal("head\n\n\n,tail\n", string(got))
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func BenchmarkConvertExcel(b *testing.B) {
+	requirement := require.New(b)
+	createDir(testDir)
+	defer os.RemoveAll(testDir)
+
+	for _, size := range []int{10000, 50000, 200000} {
+		srcFile := filepath.Join(testDir, fmt.Sprintf("bench%d.xlsx", size))
+		f := excelize.NewFile()
+		sw, err := f.NewStreamWriter("Sheet1")
+		requirement.Nil(err)
+		for i := 1; i <= size; i++ {
+			cell, _ := excelize.CoordinatesToCellName(1, i)
+			requirement.Nil(sw.SetRow(cell, []any{i, "name", float64(i) / 3, true, "2023-07-01"}))
+		}
+		requirement.Nil(sw.Flush())
+		requirement.Nil(f.SaveAs(srcFile, excelize.Options{}))
+		requirement.Nil(f.Close())
+
+		b.Run(fmt.Sprintf("rows=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			var peak uint64
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				stop := make(chan struct{})
+				done := make(chan uint64)
+				go func() {
+					var max uint64
+					var m runtime.MemStats
+					ticker := time.NewTicker(time.Millisecond)
+					defer ticker.Stop()
+					for {
+						runtime.ReadMemStats(&m)
+						if m.HeapInuse > max {
+							max = m.HeapInuse
+						}
+						select {
+						case <-stop:
+							done <- max
+							return
+						case <-ticker.C:
+						}
+					}
+				}()
+				err := ConvertExcelToCSV(srcFile)
+				close(stop)
+				if p := <-done; p > peak {
+					peak = p
+				}
+				requirement.Nil(err)
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "peak-MiB")
+		})
+	}
+}
+
+func TestConvertTextToExcel(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	csvFile := filepath.Join(testDir, "orders.csv")
+	tsvFile := filepath.Join(testDir, "orders.tsv")
+	dstFile := filepath.Join(testDir, "orders.xlsx")
+	data := "id,zip,price,day,note\n1,00123,9.5,2023-07-01,\"a, b\"\n2,10001,-3,2023-07-02 08:30:00,1234567890123456789\n"
+	requirement.Nil(os.WriteFile(csvFile, []byte(data), os.ModePerm))
+	requirement.Nil(os.WriteFile(tsvFile, []byte("name\tqty\nbox\t7\n"), os.ModePerm))
+
+	requirement.Nil(ConvertTextToExcel(dstFile, 0, csvFile, tsvFile))
+	f, err := excelize.OpenFile(dstFile)
+	requirement.Nil(err)
+	defer f.Close()
+	assertion.Equal([]string{"orders", "orders (2)"}, f.GetSheetList())
+
+	testCases := []struct {
+		sheet    string
+		cell     string
+		cellType excelize.CellType
+		expected string
+	}{
+		{"orders", "A1", excelize.CellTypeInlineString, "id"},
+		{"orders", "A2", excelize.CellTypeUnset, "1"},
+		{"orders", "B2", excelize.CellTypeInlineString, "00123"},
+		{"orders", "C2", excelize.CellTypeUnset, "9.5"},
+		{"orders", "D2", excelize.CellTypeUnset, "2023-07-01"},
+		{"orders", "E2", excelize.CellTypeInlineString, "a, b"},
+		{"orders", "C3", excelize.CellTypeUnset, "-3"},
+		{"orders", "D3", excelize.CellTypeUnset, "2023-07-02 08:30:00"},
+		{"orders", "E3", excelize.CellTypeInlineString, "1234567890123456789"},
+		{"orders (2)", "B2", excelize.CellTypeUnset, "7"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.sheet+testCase.cell, func(*testing.T) {
+			cellType, err := f.GetCellType(testCase.sheet, testCase.cell)
+			requirement.Nil(err)
+			assertion.Equal(testCase.cellType, cellType)
+			got, err := f.GetCellValue(testCase.sheet, testCase.cell)
+			requirement.Nil(err)
+			assertion.Equal(testCase.expected, got)
+		})
+	}
+
+	width, err := f.GetColWidth("orders", "E")
+	requirement.Nil(err)
+	assertion.Equal(float64(21), width)
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
 func TestConvertStringToChar(t *testing.T) {
 	assertion := assert.New(t)
 	testCases := []struct {
@@ -90,6 +586,40 @@ func TestConvertStringToChar(t *testing.T) {
 	}
 }
 
+func TestParseDelimiter(t *testing.T) {
+	assertion := assert.New(t)
+	testCases := []struct {
+		input    string
+		expected rune
+	}{
+		{",", ','},
+		{"¦", '¦'},
+		{"tab", '\t'},
+		{"TAB", '\t'},
+		{"pipe", '|'},
+		{`\t`, '\t'},
+		{`\x1f`, 0x1f},
+		{`\u00a6`, '¦'},
+		{"0x1F", 0x1f},
+		{"U+001F", 0x1f},
+		{"u+00A6", '¦'},
+		{"^A", 0x01},
+		{"^_", 0x1f},
+		{"^?", 0x7f},
+		{"US", 0x1f},
+		{"rs", 0x1e},
+	}
+	for _, testCase := range testCases {
+		r, err := ParseDelimiter(testCase.input)
+		assertion.Nil(err, testCase.input)
+		assertion.Equal(testCase.expected, r, testCase.input)
+	}
+	for _, input := range []string{"", ",;", "tabs", `\t\t`, "0x", "0xD800", "U+110000", "^1", "^AB"} {
+		_, err := ParseDelimiter(input)
+		assertion.ErrorContains(err, "not a single character", input)
+	}
+}
+
 func TestRemoveNullByteInFile(t *testing.T) {
 	assertion := assert.New(t)
 	requirement := require.New(t)
@@ -188,6 +718,65 @@ func TestReplaceDelimiter(t *testing.T) {
 			assertion.Equal(0, unexpectd)
 		})
 	}
+
+	/* A regular expression escaped old delimiter is still matched as one. */
+	file := filepath.Join(testDir, "test.txt")
+	requirement.Nil(os.WriteFile(file, []byte("a|b.c\\|d\n"), os.ModePerm))
+	requirement.Nil(ReplaceDelimiter(file, `\|`, ","))
+	b, err := os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("a,b.c\\,d\n", string(b))
+	requirement.Nil(ReplaceDelimiter(file, `\.`, `\t`))
+	b, err = os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("a,b\tc\\,d\n", string(b))
+	assertion.True(isEscapedPattern(`\\`))
+	assertion.False(isEscapedPattern(`\t`))
+	assertion.False(isEscapedPattern("::"))
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestReplaceDelimiterWithOptions(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	file := filepath.Join(testDir, "test.txt")
+	testCases := []struct {
+		name     string
+		data     string
+		old      string
+		new      string
+		opts     DelimiterOptions
+		expected string
+	}{
+		{"Literal", "a|b|c\n1|2|3\n", "|", ",", DelimiterOptions{}, "a,b,c\n1,2,3\n"},
+		{"Escape", "a\tb\r\n1\t2", `\t`, ";", DelimiterOptions{}, "a;b\r\n1;2"},
+		{"Regexp", "a|b;c\n", "[|;]", `\t`, DelimiterOptions{Regexp: true}, "a\tb\tc\n"},
+		{"Named", "a\x1fb\n", `\x1f`, "pipe", DelimiterOptions{}, "a|b\n"},
+		{"NameIsLiteral", "a cr b\r\n", "cr", ",", DelimiterOptions{}, "a , b\r\n"},
+		{"NamedCSV", "a\x1fb\n", "US", "pipe", DelimiterOptions{CSV: true}, "a|b\n"},
+		{"Multi", "a::b\n", "::", "0x09", DelimiterOptions{}, "a\tb\n"},
+		{"CSV", "id,name,note\r\n1,\"Smith, John\",a|b\r\n2,\"say \"\"hi\"\"\",\r\n", ",", "|", DelimiterOptions{CSV: true},
+			"id|name|note\r\n1|Smith, John|\"a|b\"\r\n2|\"say \"\"hi\"\"\"|\r\n"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(*testing.T) {
+			requirement.Nil(os.WriteFile(file, []byte(testCase.data), 0o640))
+			requirement.Nil(ReplaceDelimiterWithOptions(file, testCase.old, testCase.new, testCase.opts))
+			got, err := os.ReadFile(file)
+			requirement.Nil(err)
+			assertion.Equal(testCase.expected, string(got))
+			stat, err := os.Stat(file)
+			requirement.Nil(err)
+			assertion.Equal(os.FileMode(0o640), stat.Mode().Perm())
+		})
+	}
+
+	var out strings.Builder
+	err := ReplaceDelimiterStream(&out, strings.NewReader("a;b"), ";;", ",", DelimiterOptions{CSV: true})
+	assertion.ErrorContains(err, "single character")
+	err = ReplaceDelimiterStream(&out, strings.NewReader("a;b"), ";", ",,", DelimiterOptions{})
+	assertion.ErrorContains(err, "single character")
 	requirement.Nil(os.RemoveAll(testDir))
 }
 
@@ -0,0 +1,331 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/* The kinds of CSVDiffEntry. */
+const (
+	CSVDiffAdded   = "added"
+	CSVDiffRemoved = "removed"
+	CSVDiffChanged = "changed"
+)
+
+/*
+CSVDiffOptions configures DiffCSVFile.
+
+Rows are matched by the values of the Keys columns, named in the headers of both files, and the Ignore columns
+are left out of the comparison. Delimiter is chosen by the file extension of each file when it is 0.
+Both files are sorted by key first, with runs of about MemoryLimit bytes spilled to TempDir like SortFile.
+*/
+type CSVDiffOptions struct {
+	Keys        []string
+	Ignore      []string
+	Delimiter   rune
+	MemoryLimit int64
+	TempDir     string
+}
+
+/*
+CSVDiffChange is the value of a column before and after, Old is empty for an added row and New for a removed one.
+An added or removed row lists the columns of its own file, a changed row the columns of both files which differ.
+*/
+type CSVDiffChange struct {
+	Column string `json:"column"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+/* CSVDiffEntry reports a row added, removed or changed with its key values in the order of the Keys. */
+type CSVDiffEntry struct {
+	Kind    string          `json:"kind"`
+	Key     []string        `json:"key"`
+	Changes []CSVDiffChange `json:"changes"`
+}
+
+/*
+CSVDiffSummary counts the rows of both files and how they differ, AddedColumns and RemovedColumns are
+the columns only in the new file and only in the old one, which rows are not compared on.
+*/
+type CSVDiffSummary struct {
+	OldRows        int64
+	NewRows        int64
+	Added          int64
+	Removed        int64
+	Changed        int64
+	Unchanged      int64
+	AddedColumns   []string
+	RemovedColumns []string
+}
+
+/* Equal reports whether the files hold the same rows in the columns they share. */
+func (s CSVDiffSummary) Equal() bool {
+	return s.Added == 0 && s.Removed == 0 && s.Changed == 0
+}
+
+/*
+DiffCSVFile compares the delimited files by key and writes every difference to reportFile as JSON Lines
+unless it is empty. Rows sharing a key are paired in file order and the extra ones are added or removed.
+*/
+func DiffCSVFile(oldFile, newFile, reportFile string, opts CSVDiffOptions) (CSVDiffSummary, error) {
+	oldSrc, err := os.Open(oldFile)
+	if err != nil {
+		return CSVDiffSummary{}, wrapError(err)
+	}
+	defer oldSrc.Close()
+	newSrc, err := os.Open(newFile)
+	if err != nil {
+		return CSVDiffSummary{}, wrapError(err)
+	}
+	defer newSrc.Close()
+	oldComma, newComma := opts.Delimiter, opts.Delimiter
+	if opts.Delimiter == 0 {
+		oldComma, newComma = delimiterByExt(oldFile), delimiterByExt(newFile)
+	}
+	if reportFile == "" {
+		return diffCSV(io.Discard, oldSrc, newSrc, oldComma, newComma, opts)
+	}
+	var summary CSVDiffSummary
+	err = writePartFile(reportFile, func(w io.Writer) error {
+		var err error
+		summary, err = diffCSV(w, oldSrc, newSrc, oldComma, newComma, opts)
+		return err
+	})
+	return summary, err
+}
+
+/* DiffCSV compares the delimited records of oldSrc and newSrc like DiffCSVFile, the comma is the default delimiter. */
+func DiffCSV(report io.Writer, oldSrc, newSrc io.Reader, opts CSVDiffOptions) (CSVDiffSummary, error) {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	return diffCSV(report, oldSrc, newSrc, opts.Delimiter, opts.Delimiter, opts)
+}
+
+/* csvDiffSide is a file sorted by key, read back from its temporary copy. */
+type csvDiffSide struct {
+	file    *os.File
+	reader  *csv.Reader
+	columns []string
+	index   map[string]int
+	keys    []int
+	record  []string
+	rows    int64
+	hasNext bool
+}
+
+func diffCSV(report io.Writer, oldSrc, newSrc io.Reader, oldComma, newComma rune, opts CSVDiffOptions) (CSVDiffSummary, error) {
+	var summary CSVDiffSummary
+	if len(opts.Keys) == 0 {
+		return summary, wrapError(errors.New("diff needs at least one key column"))
+	}
+	dir, err := os.MkdirTemp(opts.TempDir, "diff-")
+	if err != nil {
+		return summary, wrapError(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldSide, err := newCSVDiffSide(oldSrc, filepath.Join(dir, "old.csv"), oldComma, dir, opts)
+	if err != nil {
+		return summary, err
+	}
+	defer oldSide.file.Close()
+	newSide, err := newCSVDiffSide(newSrc, filepath.Join(dir, "new.csv"), newComma, dir, opts)
+	if err != nil {
+		return summary, err
+	}
+	defer newSide.file.Close()
+
+	ignored := make(map[string]bool, len(opts.Keys)+len(opts.Ignore))
+	for _, name := range opts.Keys {
+		ignored[name] = true
+	}
+	for _, name := range opts.Ignore {
+		ignored[name] = true
+	}
+	var shared, oldColumns, newColumns []string
+	for _, name := range oldSide.columns {
+		if _, ok := newSide.index[name]; ok && !ignored[name] {
+			shared = append(shared, name)
+		} else if !ok {
+			summary.RemovedColumns = append(summary.RemovedColumns, name)
+		}
+		if !ignored[name] {
+			oldColumns = append(oldColumns, name)
+		}
+	}
+	for _, name := range newSide.columns {
+		if _, ok := oldSide.index[name]; !ok {
+			summary.AddedColumns = append(summary.AddedColumns, name)
+		}
+		if !ignored[name] {
+			newColumns = append(newColumns, name)
+		}
+	}
+
+	buf := bufio.NewWriter(report)
+	write := func(entry CSVDiffEntry) error {
+		data, err := JSONMarshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return buf.WriteByte('\n')
+	}
+	for oldSide.hasNext || newSide.hasNext {
+		c := 0
+		switch {
+		case !newSide.hasNext:
+			c = -1
+		case !oldSide.hasNext:
+			c = 1
+		default:
+			for i := range opts.Keys {
+				if c = strings.Compare(oldSide.key(i), newSide.key(i)); c != 0 {
+					break
+				}
+			}
+		}
+
+		entry := CSVDiffEntry{}
+		columns := shared
+		switch {
+		case c < 0:
+			columns = oldColumns
+		case c > 0:
+			columns = newColumns
+		}
+		for _, column := range columns {
+			change := CSVDiffChange{Column: column}
+			if c <= 0 {
+				change.Old = oldSide.field(column)
+			}
+			if c >= 0 {
+				change.New = newSide.field(column)
+			}
+			if c != 0 || change.Old != change.New {
+				entry.Changes = append(entry.Changes, change)
+			}
+		}
+		switch {
+		case c < 0:
+			summary.Removed++
+			entry.Kind = CSVDiffRemoved
+		case c > 0:
+			summary.Added++
+			entry.Kind = CSVDiffAdded
+		case len(entry.Changes) > 0:
+			summary.Changed++
+			entry.Kind = CSVDiffChanged
+		default:
+			summary.Unchanged++
+		}
+		side := oldSide
+		if c > 0 {
+			side = newSide
+		}
+		if entry.Kind != "" {
+			entry.Key = make([]string, len(opts.Keys))
+			for i := range opts.Keys {
+				entry.Key[i] = side.key(i)
+			}
+			if err = write(entry); err != nil {
+				return summary, wrapError(err)
+			}
+		}
+
+		if c <= 0 {
+			if err = oldSide.next(); err != nil {
+				return summary, err
+			}
+		}
+		if c >= 0 {
+			if err = newSide.next(); err != nil {
+				return summary, err
+			}
+		}
+	}
+	summary.OldRows, summary.NewRows = oldSide.rows, newSide.rows
+	if err = buf.Flush(); err != nil {
+		return summary, wrapError(err)
+	}
+	return summary, nil
+}
+
+/* newCSVDiffSide sorts src by the key columns into sortedFile and reads back its header and first row. */
+func newCSVDiffSide(src io.Reader, sortedFile string, comma rune, dir string, opts CSVDiffOptions) (*csvDiffSide, error) {
+	keys := make([]SortKey, len(opts.Keys))
+	for i, name := range opts.Keys {
+		keys[i] = SortKey{Name: name}
+	}
+	f, err := os.Create(sortedFile)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	side := &csvDiffSide{file: f, index: make(map[string]int)}
+	sortOpts := SortOptions{Keys: keys, Delimiter: comma, MemoryLimit: opts.MemoryLimit, TempDir: dir}
+	if _, err = SortStream(f, src, sortOpts); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, wrapError(err)
+	}
+
+	side.reader = newTextReader(bufio.NewReaderSize(f, 64*1024), comma)
+	side.reader.ReuseRecord = false
+	if side.columns, err = side.reader.Read(); err != nil {
+		f.Close()
+		return nil, wrapError(err)
+	}
+	for i, name := range side.columns {
+		name = strings.TrimPrefix(name, "\ufeff")
+		if _, ok := side.index[name]; !ok {
+			side.index[name] = i
+		}
+		side.columns[i] = name
+	}
+	for _, name := range opts.Keys {
+		side.keys = append(side.keys, side.index[name])
+	}
+	if err = side.next(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return side, nil
+}
+
+/* next reads the following row, hasNext is false at the end. */
+func (side *csvDiffSide) next() error {
+	record, err := side.reader.Read()
+	if err == io.EOF {
+		side.hasNext = false
+		return nil
+	}
+	if err != nil {
+		return wrapError(err)
+	}
+	side.record, side.hasNext = record, true
+	side.rows++
+	return nil
+}
+
+func (side *csvDiffSide) key(i int) string {
+	return sortField(side.record, side.keys[i])
+}
+
+/* field returns the value of the named column, "" when the file has no such column. */
+func (side *csvDiffSide) field(name string) string {
+	i, ok := side.index[name]
+	if !ok {
+		return ""
+	}
+	return sortField(side.record, i)
+}
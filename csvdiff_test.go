@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffCSV(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	oldData := "\ufeffregion,id,name,price,updated\nus,2,pen,1.5,09:00\neu,1,ink,3,09:00\nus,1,cap,2,09:00\nus,3,pad,4,09:00\n"
+	newData := "id,region,price,name,updated,stock\n1,eu,3,ink,10:00,5\n1,us,2.5,cap,10:00,\n4,us,1,box,10:00,7\n2,us,1.5,pen,10:00,\n"
+	opts := CSVDiffOptions{Keys: []string{"region", "id"}, Ignore: []string{"updated"}}
+	expected := []string{
+		`{"kind":"changed","key":["us","1"],"changes":[{"column":"price","old":"2","new":"2.5"}]}`,
+		`{"kind":"removed","key":["us","3"],"changes":[{"column":"name","old":"pad","new":""},{"column":"price","old":"4","new":""}]}`,
+		`{"kind":"added","key":["us","4"],"changes":[{"column":"price","old":"","new":"1"},{"column":"name","old":"","new":"box"},{"column":"stock","old":"","new":"7"}]}`,
+	}
+	for _, limit := range []int64{0, 1} {
+		opts.MemoryLimit = limit
+		var report bytes.Buffer
+		summary, err := DiffCSV(&report, strings.NewReader(oldData), strings.NewReader(newData), opts)
+		requirement.Nil(err)
+		assertion.Equal(CSVDiffSummary{
+			OldRows: 4, NewRows: 4, Added: 1, Removed: 1, Changed: 1, Unchanged: 2, AddedColumns: []string{"stock"},
+		}, summary)
+		assertion.False(summary.Equal())
+		assertion.Equal(strings.Join(expected, "\n")+"\n", report.String())
+	}
+
+	/* A column added to the new file is reported, not compared. */
+	summary, err := DiffCSV(new(bytes.Buffer), strings.NewReader("id,qty,note\n1,5,x\n"), strings.NewReader("id,qty,tag\n1,5,y\n"), CSVDiffOptions{Keys: []string{"id"}})
+	requirement.Nil(err)
+	assertion.True(summary.Equal())
+	assertion.Equal([]string{"tag"}, summary.AddedColumns)
+	assertion.Equal([]string{"note"}, summary.RemovedColumns)
+
+	summary, err = DiffCSV(new(bytes.Buffer), strings.NewReader(oldData), strings.NewReader(oldData), opts)
+	requirement.Nil(err)
+	assertion.True(summary.Equal())
+	assertion.Equal(int64(4), summary.Unchanged)
+
+	_, err = DiffCSV(new(bytes.Buffer), strings.NewReader(oldData), strings.NewReader(newData), CSVDiffOptions{})
+	assertion.Error(err)
+	_, err = DiffCSV(new(bytes.Buffer), strings.NewReader(oldData), strings.NewReader(newData), CSVDiffOptions{Keys: []string{"sku"}})
+	assertion.ErrorContains(err, `"sku" not found`)
+}
+
+func TestDiffCSVFile(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	oldFile := filepath.Join(testDir, "old.csv")
+	newFile := filepath.Join(testDir, "new.tsv")
+	reportFile := filepath.Join(testDir, "diff.jsonl")
+	requirement.Nil(os.WriteFile(oldFile, []byte("id,qty\n1,5\n1,6\n2,7\n"), os.ModePerm))
+	requirement.Nil(os.WriteFile(newFile, []byte("id\tqty\r\n2\t7\r\n1\t5\r\n"), os.ModePerm))
+
+	summary, err := DiffCSVFile(oldFile, newFile, reportFile, CSVDiffOptions{Keys: []string{"id"}, TempDir: testDir})
+	requirement.Nil(err)
+	assertion.Equal(CSVDiffSummary{OldRows: 3, NewRows: 2, Removed: 1, Unchanged: 2}, summary)
+	b, err := os.ReadFile(reportFile)
+	requirement.Nil(err)
+	assertion.Equal(`{"kind":"removed","key":["1"],"changes":[{"column":"qty","old":"6","new":""}]}`+"\n", string(b))
+
+	entries, err := os.ReadDir(testDir)
+	requirement.Nil(err)
+	assertion.Len(entries, 3)
+	requirement.Nil(os.RemoveAll(testDir))
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+)
+
+/* Line endings reported by SniffDialect. */
+const (
+	LineEndingLF   = "\n"
+	LineEndingCRLF = "\r\n"
+	LineEndingCR   = "\r"
+)
+
+/* dialectSampleSize is how many leading bytes SniffDialect inspects. */
+const dialectSampleSize = 64 * 1024
+
+/* dialectDelimiters are the delimiters SniffDialect chooses from, in order of preference. */
+var dialectDelimiters = []rune{',', '\t', '|', ';', 0x1f}
+
+/* Dialect describes the format of a delimited text file, Quote is the double quote unless fields are single-quoted. */
+type Dialect struct {
+	Delimiter  rune
+	Quote      rune
+	Header     bool
+	LineEnding string
+}
+
+/*
+SniffDialect guesses the dialect from the first 64 KiB of r, returns it with a reader yielding the whole input
+again, the sample included. An empty input gets the comma separated dialect without header.
+*/
+func SniffDialect(r io.Reader) (Dialect, io.Reader, error) {
+	sample := make([]byte, dialectSampleSize)
+	n, err := io.ReadFull(r, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Dialect{}, nil, wrapError(err)
+	}
+	sample = sample[:n]
+	return sniffDialect(sample, n == dialectSampleSize), io.MultiReader(bytes.NewReader(sample), r), nil
+}
+
+/* SniffFileDialect guesses the dialect of the file from its first 64 KiB. */
+func SniffFileDialect(filePath string) (Dialect, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return Dialect{}, wrapError(err)
+	}
+	defer f.Close()
+	d, _, err := SniffDialect(f)
+	return d, err
+}
+
+/*
+CSVReader returns a csv.Reader reading r in the dialect. Records may have different lengths,
+and since encoding/csv only unquotes '"', LazyQuotes keeps the quotes of any other quote character.
+*/
+func (d Dialect) CSVReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = d.Delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = d.Quote != '"'
+	return reader
+}
+
+/* CSVWriter returns a csv.Writer writing w in the dialect, '"' is always the quote character. */
+func (d Dialect) CSVWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	writer.Comma = d.Delimiter
+	writer.UseCRLF = d.LineEnding == LineEndingCRLF
+	return writer
+}
+
+/* DelimiterString returns the delimiter as ReplaceDelimiter takes it. */
+func (d Dialect) DelimiterString() string {
+	return string(d.Delimiter)
+}
+
+/* sniffDialect guesses the dialect of the sample, the last row of a truncated sample is ignored. */
+func sniffDialect(sample []byte, truncated bool) Dialect {
+	d := Dialect{Delimiter: ',', Quote: sniffQuote(sample), LineEnding: sniffLineEnding(sample)}
+
+	var best [][]string
+	var bestScore float64
+	var bestWidth int
+	for _, delimiter := range dialectDelimiters {
+		rows := splitDialectRows(sample, delimiter, d.Quote, truncated)
+		score, width := delimiterConsistency(rows)
+		if score > bestScore || score == bestScore && width > bestWidth {
+			d.Delimiter, best, bestScore, bestWidth = delimiter, rows, score, width
+		}
+	}
+	if best == nil {
+		best = splitDialectRows(sample, d.Delimiter, d.Quote, truncated)
+	}
+	d.Header = sniffHeader(best)
+	return d
+}
+
+/* sniffLineEnding returns the most frequent line ending of the sample, LF when there is none. */
+func sniffLineEnding(sample []byte) string {
+	e, _ := CountLineEndings(bytes.NewReader(sample))
+	return e.Dominant()
+}
+
+/* sniffQuote returns the single quote when more fields start and end with it than with the double quote. */
+func sniffQuote(sample []byte) rune {
+	count := func(quote byte) int {
+		var n int
+		for i := 0; i < len(sample); i++ {
+			if sample[i] != quote || i > 0 && !isDialectBoundary(sample[i-1]) {
+				continue
+			}
+			end := bytes.IndexByte(sample[i+1:], quote)
+			if end < 0 {
+				break
+			}
+			i += end + 1
+			if i+1 == len(sample) || isDialectBoundary(sample[i+1]) {
+				n++
+			}
+		}
+		return n
+	}
+	if count('\'') > count('"') {
+		return '\''
+	}
+	return '"'
+}
+
+/* isDialectBoundary reports whether the byte can end a field: a line break or a candidate delimiter. */
+func isDialectBoundary(b byte) bool {
+	if b == '\n' || b == '\r' {
+		return true
+	}
+	for _, delimiter := range dialectDelimiters {
+		if rune(b) == delimiter {
+			return true
+		}
+	}
+	return false
+}
+
+/* splitDialectRows splits the sample into rows of fields, quoted fields may hold delimiters, quotes and line breaks. */
+func splitDialectRows(sample []byte, delimiter, quote rune, truncated bool) [][]string {
+	var rows [][]string
+	var row []string
+	var field []byte
+	quoted := false
+	for i := 0; i < len(sample); i++ {
+		b := sample[i]
+		switch {
+		case quoted && rune(b) == quote:
+			if i+1 < len(sample) && rune(sample[i+1]) == quote {
+				field = append(field, b)
+				i++
+			} else {
+				quoted = false
+			}
+		case quoted:
+			field = append(field, b)
+		case rune(b) == quote && len(field) == 0:
+			quoted = true
+		case rune(b) == delimiter:
+			row = append(row, string(field))
+			field = field[:0]
+		case b == '\n' || b == '\r':
+			if b == '\r' && i+1 < len(sample) && sample[i+1] == '\n' {
+				i++
+			}
+			rows = append(rows, append(row, string(field)))
+			row, field = nil, field[:0]
+		default:
+			field = append(field, b)
+		}
+	}
+	if !truncated && (len(row) != 0 || len(field) != 0) {
+		rows = append(rows, append(row, string(field)))
+	}
+	return rows
+}
+
+/*
+delimiterConsistency returns the share of the non-blank rows having the most frequent number of fields,
+and that number. A delimiter that never splits a row scores 0.
+*/
+func delimiterConsistency(rows [][]string) (float64, int) {
+	counts := make(map[int]int)
+	var total int
+	for _, row := range rows {
+		if len(row) == 1 && row[0] == "" {
+			continue
+		}
+		counts[len(row)]++
+		total++
+	}
+	var width, n int
+	for w, c := range counts {
+		if c > n || c == n && w > width {
+			width, n = w, c
+		}
+	}
+	if width < 2 {
+		return 0, width
+	}
+	return float64(n) / float64(total), width
+}
+
+/*
+sniffHeader votes on every column whose values below the first row share a kind, number, date or length:
+a first row cell of another kind votes for a header, one of the same kind against it.
+*/
+func sniffHeader(rows [][]string) bool {
+	if len(rows) < 2 {
+		return false
+	}
+	header := rows[0]
+	var votes int
+	for i, name := range header {
+		kind := ""
+		consistent := true
+		for _, row := range rows[1:] {
+			if i >= len(row) || row[i] == "" {
+				continue
+			}
+			k := dialectValueKind(row[i])
+			if kind == "" {
+				kind = k
+			} else if k != kind {
+				consistent = false
+				break
+			}
+		}
+		if !consistent || kind == "" {
+			continue
+		}
+		if dialectValueKind(name) == kind {
+			votes--
+		} else {
+			votes++
+		}
+	}
+	return votes > 0
+}
+
+/* dialectValueKind classifies the value as a number, a date or text of its length. */
+func dialectValueKind(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "number"
+	}
+	if _, err := parseParquetValue(value, ParquetTimestamp); err == nil {
+		return "date"
+	}
+	if _, err := parseParquetValue(value, ParquetDate); err == nil {
+		return "date"
+	}
+	return "text:" + strconv.Itoa(len([]rune(value)))
+}
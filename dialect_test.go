@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffDialect(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	testCases := []struct {
+		name     string
+		input    string
+		expected Dialect
+	}{
+		{
+			name:     "CSV",
+			input:    "id,name,price\n1,\"Smith, John\",9.5\n2,Jane,10\n",
+			expected: Dialect{',', '"', true, LineEndingLF},
+		},
+		{
+			name:     "TSV",
+			input:    "a, b\tx\t1\r\nc, d\ty\t2\r\ne, f\tz\t3\r\n",
+			expected: Dialect{'\t', '"', false, LineEndingCRLF},
+		},
+		{
+			name:     "Pipe",
+			input:    "day|amount|note\n2023-07-01|5|\"a|b\"\n2023-07-02|6|c\n",
+			expected: Dialect{'|', '"', true, LineEndingLF},
+		},
+		{
+			name:     "Semicolon",
+			input:    "'x;y';1;2023-07-01\r'z';2;2023-07-02\r",
+			expected: Dialect{';', '\'', false, LineEndingCR},
+		},
+		{
+			name:     "UnitSeparator",
+			input:    "id\x1fname\n1\x1fa,b\n2\x1fc,d\n",
+			expected: Dialect{0x1f, '"', true, LineEndingLF},
+		},
+		{
+			name:     "Empty",
+			input:    "",
+			expected: Dialect{',', '"', false, LineEndingLF},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(*testing.T) {
+			d, r, err := SniffDialect(strings.NewReader(testCase.input))
+			requirement.Nil(err)
+			assertion.Equal(testCase.expected, d)
+			got, err := io.ReadAll(r)
+			requirement.Nil(err)
+			assertion.Equal(testCase.input, string(got))
+		})
+	}
+}
+
+func TestDialectPlugIn(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	file := filepath.Join(testDir, "feed.txt")
+	requirement.Nil(os.WriteFile(file, []byte("id|name\r\n1|Zoë\r\n2|Bob\r\n"), os.ModePerm))
+
+	d, err := SniffFileDialect(file)
+	requirement.Nil(err)
+	f, err := os.Open(file)
+	requirement.Nil(err)
+	records, err := d.CSVReader(f).ReadAll()
+	requirement.Nil(err)
+	requirement.Nil(f.Close())
+	assertion.Equal([][]string{{"id", "name"}, {"1", "Zoë"}, {"2", "Bob"}}, records)
+
+	var out strings.Builder
+	w := d.CSVWriter(&out)
+	requirement.Nil(w.WriteAll(records))
+	assertion.Equal("id|name\r\n1|Zoë\r\n2|Bob\r\n", out.String())
+
+	requirement.Nil(ReplaceDelimiterWithOptions(file, d.DelimiterString(), ",", DelimiterOptions{CSV: true}))
+	got, err := os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("id,name\r\n1,Zoë\r\n2,Bob\r\n", string(got))
+	requirement.Nil(os.RemoveAll(testDir))
+}
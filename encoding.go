@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+/* Encoding names returned by DetectEncoding, the other WHATWG names like euc-kr are accepted as well. */
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingBig5        = "big5"
+	EncodingGBK         = "gbk"
+	EncodingShiftJIS    = "shift_jis"
+	EncodingWindows1252 = "windows-1252"
+)
+
+/* encodingSampleSize is how many leading bytes are inspected to detect the encoding of a stream. */
+const encodingSampleSize = 64 * 1024
+
+/* utf8BOM is the UTF-8 byte order mark. */
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+/*
+DetectEncoding guesses the encoding of the data from its byte order mark,
+otherwise from the byte patterns of UTF-16, UTF-8, GBK, Big5 and Shift-JIS.
+Data none of them fits is reported as windows-1252.
+*/
+func DetectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return EncodingUTF8
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		return EncodingUTF16BE
+	}
+	if enc := detectUTF16(data); enc != "" {
+		return enc
+	}
+	if validUTF8Prefix(data) {
+		return EncodingUTF8
+	}
+
+	best, bestScore := EncodingWindows1252, 0.0
+	for _, candidate := range []struct {
+		name  string
+		score func([]byte) float64
+	}{
+		{EncodingGBK, scoreGBK},
+		{EncodingBig5, scoreBig5},
+		{EncodingShiftJIS, scoreShiftJIS},
+	} {
+		if score := candidate.score(data); score > bestScore {
+			best, bestScore = candidate.name, score
+		}
+	}
+	return best
+}
+
+/* DetectFileEncoding guesses the encoding of the file from its first 64 KiB. */
+func DetectFileEncoding(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	defer f.Close()
+	sample := make([]byte, encodingSampleSize)
+	n, err := io.ReadFull(f, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", wrapError(err)
+	}
+	return DetectEncoding(sample[:n]), nil
+}
+
+/*
+NewUTF8Reader returns a reader decoding r from the named encoding to UTF-8 and the name of the encoding,
+which is detected from the first 64 KiB when name is empty. A leading byte order mark is removed.
+*/
+func NewUTF8Reader(r io.Reader, name string) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, encodingSampleSize)
+	if name == "" {
+		sample, err := br.Peek(encodingSampleSize)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, "", wrapError(err)
+		}
+		name = DetectEncoding(sample)
+	}
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return transform.NewReader(br, unicode.BOMOverride(enc.NewDecoder())), name, nil
+}
+
+/*
+NewUTF8Writer returns a writer transcoding the bytes written to it from the named encoding to UTF-8 on w.
+Close flushes the pending bytes and doesn't close w.
+*/
+func NewUTF8Writer(w io.Writer, name string) (io.WriteCloser, error) {
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewWriter(w, unicode.BOMOverride(enc.NewDecoder())), nil
+}
+
+/*
+ConvertFileToUTF8 transcodes the file in place from the named encoding to UTF-8 without byte order mark,
+rewritten as opts say, returns the name of the source encoding, which is detected when name is empty.
+*/
+func ConvertFileToUTF8(filePath, name string, opts ...RewriteOptions) (string, error) {
+	if name == "" {
+		var err error
+		if name, err = DetectFileEncoding(filePath); err != nil {
+			return "", err
+		}
+	}
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return "", err
+	}
+	return name, RewriteFile(filePath, rewriteOptions(opts), func(r io.Reader, w io.Writer) error {
+		if _, err := io.Copy(w, transform.NewReader(r, unicode.BOMOverride(enc.NewDecoder()))); err != nil {
+			return wrapError(err)
+		}
+		return nil
+	})
+}
+
+/* StripBOM removes the UTF-8 byte order mark from the start of the data. */
+func StripBOM(data []byte) []byte {
+	return bytes.TrimPrefix(data, utf8BOM)
+}
+
+/* AddBOM prepends the UTF-8 byte order mark to the data unless it already starts with it. */
+func AddBOM(data []byte) []byte {
+	if bytes.HasPrefix(data, utf8BOM) {
+		return data
+	}
+	return append(append(make([]byte, 0, len(data)+len(utf8BOM)), utf8BOM...), data...)
+}
+
+/* lookupEncoding returns the encoding by its WHATWG name or label. */
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, wrapError(errors.New("unknown encoding " + name))
+	}
+	return enc, nil
+}
+
+/* detectUTF16 recognizes UTF-16 without byte order mark by the zero bytes of its ASCII characters. */
+func detectUTF16(data []byte) string {
+	var even, odd int
+	pairs := len(data) / 2
+	if pairs < 2 {
+		return ""
+	}
+	for i := 0; i+1 < len(data); i += 2 {
+		if data[i] == 0 {
+			even++
+		}
+		if data[i+1] == 0 {
+			odd++
+		}
+	}
+	switch {
+	case odd*5 >= pairs*2 && even*10 < pairs:
+		return EncodingUTF16LE
+	case even*5 >= pairs*2 && odd*10 < pairs:
+		return EncodingUTF16BE
+	}
+	return ""
+}
+
+/* validUTF8Prefix reports whether the data is UTF-8, a rune cut at the end of a sample is ignored. */
+func validUTF8Prefix(data []byte) bool {
+	if utf8.Valid(data) {
+		return true
+	}
+	i := len(data) - 1
+	for i > 0 && len(data)-i < utf8.UTFMax && !utf8.RuneStart(data[i]) {
+		i--
+	}
+	return i >= 0 && !utf8.FullRune(data[i:]) && utf8.Valid(data[:i])
+}
+
+/*
+scoreCJK walks the data with the double-byte grammar of an encoding and returns the share of the
+non-ASCII characters in its frequent range. Data with more than 5% invalid sequences scores 0.
+*/
+func scoreCJK(data []byte, single func(b byte) bool, pair func(lead, trail byte) (valid, common bool)) float64 {
+	var total, common, invalid int
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		if b < 0x80 {
+			continue
+		}
+		total++
+		if single(b) {
+			continue
+		}
+		if i+1 == len(data) {
+			break
+		}
+		valid, frequent := pair(b, data[i+1])
+		switch {
+		case !valid:
+			invalid++
+		case frequent:
+			common++
+			i++
+		default:
+			i++
+		}
+	}
+	if total == 0 || invalid*20 > total {
+		return 0
+	}
+	return float64(common) / float64(total)
+}
+
+/* scoreGBK scores the data as GBK, the frequent range is the GB2312 punctuation and level-1 hanzi. */
+func scoreGBK(data []byte) float64 {
+	return scoreCJK(data, func(byte) bool { return false }, func(lead, trail byte) (bool, bool) {
+		valid := lead >= 0x81 && lead <= 0xfe && trail >= 0x40 && trail <= 0xfe && trail != 0x7f
+		return valid, trail >= 0xa1 && (lead >= 0xa1 && lead <= 0xa3 || lead >= 0xb0 && lead <= 0xd7)
+	})
+}
+
+/* scoreBig5 scores the data as Big5, the frequent range is the punctuation and the frequently used hanzi. */
+func scoreBig5(data []byte) float64 {
+	return scoreCJK(data, func(byte) bool { return false }, func(lead, trail byte) (bool, bool) {
+		valid := lead >= 0xa1 && lead <= 0xf9 && (trail >= 0x40 && trail <= 0x7e || trail >= 0xa1 && trail <= 0xfe)
+		return valid, lead == 0xa1 || lead >= 0xa4 && lead <= 0xc6
+	})
+}
+
+/* scoreShiftJIS scores the data as Shift-JIS, the frequent range is the kana and the level-1 kanji. */
+func scoreShiftJIS(data []byte) float64 {
+	return scoreCJK(data, func(b byte) bool { return b >= 0xa1 && b <= 0xdf }, func(lead, trail byte) (bool, bool) {
+		valid := (lead >= 0x81 && lead <= 0x9f || lead >= 0xe0 && lead <= 0xfc) &&
+			(trail >= 0x40 && trail <= 0x7e || trail >= 0x80 && trail <= 0xfc)
+		return valid, lead >= 0x81 && lead <= 0x83 || lead >= 0x88 && lead <= 0x98
+	})
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var testEncodings = []struct {
+	name string
+	text string
+	enc  encoding.Encoding
+}{
+	{EncodingUTF8, "id,name\n1,Zoë\n2,東京\n", unicode.UTF8},
+	{EncodingUTF16LE, "id,name\n1,王小明\n", unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)},
+	{EncodingUTF16BE, "id,name\n1,王小明\n", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)},
+	{EncodingGBK, "编号,姓名,城市\n1,王小明,北京市朝阳区\n2,李华,上海市浦东新区\n", simplifiedchinese.GBK},
+	{EncodingBig5, "編號,姓名,城市\n1,王小明,台北市信義區\n2,李華,高雄市前鎮區\n", traditionalchinese.Big5},
+	{EncodingShiftJIS, "番号,名前,住所\n1,やまだ たろう,東京都新宿区\n2,さとう はなこ,大阪市北区\n", japanese.ShiftJIS},
+	{EncodingWindows1252, "id,name\n1,Café crème\n", encoding.Nop},
+}
+
+func TestDetectEncoding(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	for _, testCase := range testEncodings {
+		data := []byte(testCase.text)
+		if testCase.name == EncodingWindows1252 {
+			data = []byte("id,name\n1,Caf\xe9 cr\xe8me\n")
+		} else {
+			var err error
+			data, err = testCase.enc.NewEncoder().Bytes(data)
+			requirement.Nil(err, testCase.name)
+		}
+		assertion.Equal(testCase.name, DetectEncoding(data), testCase.name)
+
+		r, name, err := NewUTF8Reader(bytes.NewReader(data), "")
+		requirement.Nil(err)
+		assertion.Equal(testCase.name, name)
+		got, err := io.ReadAll(r)
+		requirement.Nil(err)
+		assertion.Equal(testCase.text, string(got), testCase.name)
+	}
+	assertion.Equal(EncodingUTF8, DetectEncoding([]byte("東京")[:4]))
+}
+
+func TestUTF8Writer(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	data, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte("東京都"))
+	requirement.Nil(err)
+	var buf bytes.Buffer
+	w, err := NewUTF8Writer(&buf, EncodingShiftJIS)
+	requirement.Nil(err)
+	for _, b := range data {
+		_, err = w.Write([]byte{b})
+		requirement.Nil(err)
+	}
+	requirement.Nil(w.Close())
+	assertion.Equal("東京都", buf.String())
+
+	_, err = NewUTF8Writer(&buf, "klingon")
+	assertion.ErrorContains(err, "unknown encoding")
+}
+
+func TestConvertFileToUTF8(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	file := filepath.Join(testDir, "feed.csv")
+	data, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes([]byte("a\tb\r\n1\t2\r\n"))
+	requirement.Nil(err)
+	requirement.Nil(os.WriteFile(file, data, 0o640))
+
+	name, err := ConvertFileToUTF8(file, "")
+	requirement.Nil(err)
+	assertion.Equal(EncodingUTF16LE, name)
+	got, err := os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("a\tb\r\n1\t2\r\n", string(got))
+	stat, err := os.Stat(file)
+	requirement.Nil(err)
+	assertion.Equal(os.FileMode(0o640), stat.Mode().Perm())
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestBOM(t *testing.T) {
+	assertion := assert.New(t)
+	withBOM := AddBOM([]byte("a,b"))
+	assertion.Equal("\xef\xbb\xbfa,b", string(withBOM))
+	assertion.Equal(withBOM, AddBOM(withBOM))
+	assertion.Equal("a,b", string(StripBOM(withBOM)))
+	assertion.Equal("a,b", string(StripBOM([]byte("a,b"))))
+}
@@ -0,0 +1,460 @@
+package utils
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* SortKey orders the records by a column, found by its header Name or else its 0-based Index. */
+type SortKey struct {
+	Name    string
+	Index   int
+	Numeric bool
+	Desc    bool
+}
+
+/*
+SortOptions configures SortFile.
+
+Records are ordered by the Keys in turn, by all their fields when there is none. A Numeric key puts
+the finite numbers in numeric order before the other values, NaN and Inf included, which keep their string order.
+Delimiter is chosen by the file extension when it is 0 and the first row is a header kept on top unless NoHeader is set.
+Dedupe keeps only the first record of every key. Sorted runs of about MemoryLimit bytes, 64 MiB by default,
+are spilled to temporary files in TempDir, the system one when empty.
+*/
+type SortOptions struct {
+	Keys        []SortKey
+	Delimiter   rune
+	NoHeader    bool
+	Dedupe      bool
+	MemoryLimit int64
+	TempDir     string
+}
+
+/* SortStats counts the records written, the duplicates dropped and the runs spilled to disk. */
+type SortStats struct {
+	Records    int64
+	Duplicates int64
+	Runs       int
+}
+
+/* SortFile sorts the delimited file into dstFile, which may be the source file itself. */
+func SortFile(srcFile, dstFile string, opts SortOptions) (SortStats, error) {
+	f, err := os.Open(srcFile)
+	if err != nil {
+		return SortStats{}, wrapError(err)
+	}
+	defer f.Close()
+	if opts.Delimiter == 0 {
+		opts.Delimiter = delimiterByExt(srcFile)
+	}
+	var stats SortStats
+	err = writePartFile(dstFile, func(w io.Writer) error {
+		var err error
+		stats, err = SortStream(w, f, opts)
+		return err
+	})
+	return stats, err
+}
+
+/* SortStream sorts the delimited records of src into dst like SortFile, the comma is the default delimiter. */
+func SortStream(dst io.Writer, src io.Reader, opts SortOptions) (SortStats, error) {
+	var stats SortStats
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	if opts.MemoryLimit <= 0 {
+		opts.MemoryLimit = 64 << 20
+	}
+	br := bufio.NewReaderSize(src, 64*1024)
+	head, _ := br.Peek(br.Size())
+	reader := newTextReader(br, opts.Delimiter)
+	reader.ReuseRecord = false
+
+	buf := bufio.NewWriter(dst)
+	writer := csv.NewWriter(buf)
+	writer.Comma = opts.Delimiter
+	writer.UseCRLF = sniffLineEnding(head) == LineEndingCRLF
+
+	var header []string
+	if !opts.NoHeader {
+		record, err := reader.Read()
+		if err != nil && err != io.EOF {
+			return stats, wrapError(err)
+		}
+		if header = record; header != nil {
+			if err = writer.Write(header); err != nil {
+				return stats, wrapError(err)
+			}
+		}
+	}
+	keys, err := resolveSortKeys(opts.Keys, header)
+	if err != nil {
+		return stats, err
+	}
+	s := &externalSorter{keys: keys, opts: opts}
+	defer s.cleanup()
+
+	var run []sortRecord
+	var size int64
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, wrapError(err)
+		}
+		run = append(run, s.newRecord(record))
+		for _, field := range record {
+			size += int64(len(field)) + 16
+		}
+		if size += 64; size >= opts.MemoryLimit {
+			if err = s.spill(run); err != nil {
+				return stats, err
+			}
+			run, size = run[:0], 0
+		}
+	}
+
+	emit := func(rec sortRecord, last *sortRecord) error {
+		if opts.Dedupe && last != nil && s.compare(*last, rec) == 0 {
+			stats.Duplicates++
+			return nil
+		}
+		stats.Records++
+		return writer.Write(rec.fields)
+	}
+	if len(s.runs) == 0 {
+		sort.SliceStable(run, func(i, j int) bool { return s.compare(run[i], run[j]) < 0 })
+		for i := range run {
+			var last *sortRecord
+			if i > 0 {
+				last = &run[i-1]
+			}
+			if err = emit(run[i], last); err != nil {
+				return stats, wrapError(err)
+			}
+		}
+	} else {
+		if len(run) > 0 {
+			if err = s.spill(run); err != nil {
+				return stats, err
+			}
+		}
+		if err = s.merge(emit); err != nil {
+			return stats, err
+		}
+	}
+	stats.Runs = s.spilled
+
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return stats, wrapError(err)
+	}
+	if err = buf.Flush(); err != nil {
+		return stats, wrapError(err)
+	}
+	return stats, nil
+}
+
+/* resolveSortKeys finds the column of every named key in the header. */
+func resolveSortKeys(keys []SortKey, header []string) ([]SortKey, error) {
+	resolved := make([]SortKey, len(keys))
+	for i, key := range keys {
+		if key.Name != "" {
+			key.Index = -1
+			for j, name := range header {
+				if strings.TrimPrefix(name, "\ufeff") == key.Name {
+					key.Index = j
+					break
+				}
+			}
+			if key.Index < 0 {
+				return nil, wrapError(fmt.Errorf("sort column %q not found in the header", key.Name))
+			}
+		}
+		if key.Index < 0 {
+			return nil, wrapError(fmt.Errorf("sort column index %d is negative", key.Index))
+		}
+		resolved[i] = key
+	}
+	return resolved, nil
+}
+
+/* sortRecord is a record with the parsed numbers of its numeric keys. */
+type sortRecord struct {
+	fields []string
+	nums   []float64
+	isNum  []bool
+}
+
+/* externalSorter holds the keys and the sorted runs spilled to temporary files. */
+type externalSorter struct {
+	keys    []SortKey
+	opts    SortOptions
+	dir     string
+	runs    []string
+	spilled int
+}
+
+func (s *externalSorter) newRecord(fields []string) sortRecord {
+	rec := sortRecord{fields: fields}
+	for i, key := range s.keys {
+		if !key.Numeric {
+			continue
+		}
+		if rec.nums == nil {
+			rec.nums = make([]float64, len(s.keys))
+			rec.isNum = make([]bool, len(s.keys))
+		}
+		if key.Index < len(fields) {
+			v, err := strconv.ParseFloat(strings.TrimSpace(fields[key.Index]), 64)
+			rec.nums[i], rec.isNum[i] = v, err == nil && !math.IsNaN(v) && !math.IsInf(v, 0)
+		}
+	}
+	return rec
+}
+
+/* compare orders two records by the keys, by all their fields when there is none. */
+func (s *externalSorter) compare(a, b sortRecord) int {
+	if len(s.keys) == 0 {
+		for i := 0; i < len(a.fields) && i < len(b.fields); i++ {
+			if c := strings.Compare(a.fields[i], b.fields[i]); c != 0 {
+				return c
+			}
+		}
+		return len(a.fields) - len(b.fields)
+	}
+	for i, key := range s.keys {
+		var c int
+		switch {
+		case key.Numeric && a.isNum[i] && b.isNum[i]:
+			if a.nums[i] < b.nums[i] {
+				c = -1
+			} else if a.nums[i] > b.nums[i] {
+				c = 1
+			}
+		case key.Numeric && a.isNum[i] != b.isNum[i]:
+			c = 1
+			if a.isNum[i] {
+				c = -1
+			}
+		default:
+			c = strings.Compare(sortField(a.fields, key.Index), sortField(b.fields, key.Index))
+		}
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+/* sortField returns the field at i, "" when the record is shorter. */
+func sortField(fields []string, i int) string {
+	if i < len(fields) {
+		return fields[i]
+	}
+	return ""
+}
+
+/* spill sorts the run and writes it to a new temporary file. */
+func (s *externalSorter) spill(run []sortRecord) error {
+	sort.SliceStable(run, func(i, j int) bool { return s.compare(run[i], run[j]) < 0 })
+	name, err := s.writeRun(func(write func(sortRecord) error) error {
+		for _, rec := range run {
+			if err := write(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, name)
+	s.spilled++
+	return nil
+}
+
+/* writeRun creates a temporary run file and writes to it the records fill passes to write. */
+func (s *externalSorter) writeRun(fill func(write func(sortRecord) error) error) (string, error) {
+	if s.dir == "" {
+		dir, err := os.MkdirTemp(s.opts.TempDir, "sort-")
+		if err != nil {
+			return "", wrapError(err)
+		}
+		s.dir = dir
+	}
+	f, err := os.CreateTemp(s.dir, "run-*.csv")
+	if err != nil {
+		return "", wrapError(err)
+	}
+	defer f.Close()
+
+	buf := bufio.NewWriterSize(f, 64*1024)
+	writer := csv.NewWriter(buf)
+	writer.Comma = s.opts.Delimiter
+	if err = fill(func(rec sortRecord) error { return writer.Write(rec.fields) }); err != nil {
+		return "", wrapError(err)
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return "", wrapError(err)
+	}
+	if err = buf.Flush(); err != nil {
+		return "", wrapError(err)
+	}
+	if err = f.Close(); err != nil {
+		return "", wrapError(err)
+	}
+	return f.Name(), nil
+}
+
+/* sortMergeWidth is the number of runs merged at once, more runs are merged in several passes. */
+const sortMergeWidth = 64
+
+/*
+merge k-way merges the runs, records of equal keys come in the order of their runs, so in input order.
+While there are more than sortMergeWidth runs, consecutive groups of them are merged into intermediate runs.
+*/
+func (s *externalSorter) merge(emit func(rec sortRecord, last *sortRecord) error) error {
+	for len(s.runs) > sortMergeWidth {
+		var runs []string
+		for i := 0; i < len(s.runs); i += sortMergeWidth {
+			group := s.runs[i:]
+			if len(group) > sortMergeWidth {
+				group = group[:sortMergeWidth]
+			}
+			if len(group) == 1 {
+				runs = append(runs, group[0])
+				continue
+			}
+			name, err := s.writeRun(func(write func(sortRecord) error) error {
+				return s.mergeRuns(group, write)
+			})
+			if err != nil {
+				return err
+			}
+			for _, run := range group {
+				os.Remove(run)
+			}
+			runs = append(runs, name)
+		}
+		s.runs = runs
+	}
+
+	var last sortRecord
+	var emitted bool
+	return s.mergeRuns(s.runs, func(rec sortRecord) error {
+		var prev *sortRecord
+		if emitted {
+			prev = &last
+		}
+		if err := emit(rec, prev); err != nil {
+			return wrapError(err)
+		}
+		last, emitted = rec, true
+		return nil
+	})
+}
+
+/* mergeRuns passes the records of the runs to emit in order, the runs are open until it returns. */
+func (s *externalSorter) mergeRuns(runs []string, emit func(rec sortRecord) error) error {
+	h := &sortHeap{sorter: s}
+	for i, name := range runs {
+		f, err := os.Open(name)
+		if err != nil {
+			return wrapError(err)
+		}
+		defer f.Close()
+		reader := newTextReader(bufio.NewReaderSize(f, 64*1024), s.opts.Delimiter)
+		reader.ReuseRecord = false
+		h.readers = append(h.readers, reader)
+		if err = h.next(i); err != nil {
+			return err
+		}
+	}
+	heap.Init(h)
+
+	for h.Len() > 0 {
+		item := h.items[0]
+		if err := emit(item.rec); err != nil {
+			return err
+		}
+		fields, err := h.readers[item.run].Read()
+		if err == io.EOF {
+			heap.Pop(h)
+			continue
+		}
+		if err != nil {
+			return wrapError(err)
+		}
+		h.items[0].rec = s.newRecord(fields)
+		heap.Fix(h, 0)
+	}
+	return nil
+}
+
+func (s *externalSorter) cleanup() {
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
+
+/* sortHeapItem is the current record of a run. */
+type sortHeapItem struct {
+	rec sortRecord
+	run int
+}
+
+/* sortHeap orders the current records of the runs, ties by run. */
+type sortHeap struct {
+	sorter  *externalSorter
+	readers []*csv.Reader
+	items   []sortHeapItem
+}
+
+/* next pushes the first record of the run unless it is empty. */
+func (h *sortHeap) next(run int) error {
+	fields, err := h.readers[run].Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return wrapError(err)
+	}
+	h.items = append(h.items, sortHeapItem{rec: h.sorter.newRecord(fields), run: run})
+	return nil
+}
+
+func (h *sortHeap) Len() int { return len(h.items) }
+
+func (h *sortHeap) Less(i, j int) bool {
+	if c := h.sorter.compare(h.items[i].rec, h.items[j].rec); c != 0 {
+		return c < 0
+	}
+	return h.items[i].run < h.items[j].run
+}
+
+func (h *sortHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *sortHeap) Push(x any) { h.items = append(h.items, x.(sortHeapItem)) }
+
+func (h *sortHeap) Pop() any {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortStream(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	data := "id,name,score\n3,bob,9.5\n10,amy,n/a\n2,\"lee, jo\",9.5\n3,ann,7\n1,amy,12\n"
+	testCases := []struct {
+		name       string
+		opts       SortOptions
+		expected   string
+		duplicates int64
+	}{
+		{
+			"String", SortOptions{Keys: []SortKey{{Name: "id"}}},
+			"id,name,score\n1,amy,12\n10,amy,n/a\n2,\"lee, jo\",9.5\n3,bob,9.5\n3,ann,7\n", 0,
+		},
+		{
+			"Numeric", SortOptions{Keys: []SortKey{{Name: "id", Numeric: true}}},
+			"id,name,score\n1,amy,12\n2,\"lee, jo\",9.5\n3,bob,9.5\n3,ann,7\n10,amy,n/a\n", 0,
+		},
+		{
+			"MultiKey", SortOptions{Keys: []SortKey{{Name: "score", Numeric: true, Desc: true}, {Index: 1}}},
+			"id,name,score\n10,amy,n/a\n1,amy,12\n3,bob,9.5\n2,\"lee, jo\",9.5\n3,ann,7\n", 0,
+		},
+		{
+			"Dedupe", SortOptions{Keys: []SortKey{{Name: "id", Numeric: true}}, Dedupe: true},
+			"id,name,score\n1,amy,12\n2,\"lee, jo\",9.5\n3,bob,9.5\n10,amy,n/a\n", 1,
+		},
+		{
+			"NoHeader", SortOptions{NoHeader: true, Dedupe: true},
+			"1,amy,12\n10,amy,n/a\n2,\"lee, jo\",9.5\n3,ann,7\n3,bob,9.5\nid,name,score\n", 0,
+		},
+	}
+	for _, testCase := range testCases {
+		for _, limit := range []int64{0, 1} {
+			/* A limit of one byte spills every record to its own run. */
+			opts := testCase.opts
+			opts.MemoryLimit = limit
+			opts.TempDir = t.TempDir()
+			var out bytes.Buffer
+			stats, err := SortStream(&out, strings.NewReader(data), opts)
+			requirement.Nil(err, testCase.name)
+			assertion.Equal(testCase.expected, out.String(), "%s %d", testCase.name, limit)
+			assertion.Equal(testCase.duplicates, stats.Duplicates, testCase.name)
+			if limit == 1 {
+				assertion.Equal(int(stats.Records+stats.Duplicates), stats.Runs, testCase.name)
+			}
+			entries, err := os.ReadDir(opts.TempDir)
+			requirement.Nil(err)
+			assertion.Empty(entries)
+		}
+	}
+
+	/* NaN and Inf are not numbers, so they neither sort among them nor count as duplicates. */
+	var out bytes.Buffer
+	stats, err := SortStream(&out, strings.NewReader("k,v\n1,a\nNaN,b\n2,c\n-Inf,d\nNaN,e\n"),
+		SortOptions{Keys: []SortKey{{Name: "k", Numeric: true}}, Dedupe: true})
+	requirement.Nil(err)
+	assertion.Equal("k,v\n1,a\n2,c\n-Inf,d\nNaN,b\n", out.String())
+	assertion.Equal(int64(1), stats.Duplicates)
+
+	_, err = SortStream(new(bytes.Buffer), strings.NewReader(data), SortOptions{Keys: []SortKey{{Name: "age"}}})
+	assertion.ErrorContains(err, `"age" not found`)
+
+	/* More runs than sortMergeWidth are merged in several passes, keeping equal keys in input order. */
+	var many, expected, first strings.Builder
+	many.WriteString("key,seq\n")
+	expected.WriteString("key,seq\n")
+	first.WriteString("key,seq\n")
+	n := 3*sortMergeWidth + 7
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&many, "%d,%d\n", (n-i)%10, i)
+	}
+	for key := 0; key < 10; key++ {
+		found := false
+		for i := 0; i < n; i++ {
+			if (n-i)%10 == key {
+				fmt.Fprintf(&expected, "%d,%d\n", key, i)
+				if !found {
+					fmt.Fprintf(&first, "%d,%d\n", key, i)
+					found = true
+				}
+			}
+		}
+	}
+	opts := SortOptions{Keys: []SortKey{{Name: "key", Numeric: true}}, MemoryLimit: 1, TempDir: t.TempDir()}
+	out.Reset()
+	stats, err = SortStream(&out, strings.NewReader(many.String()), opts)
+	requirement.Nil(err)
+	assertion.Equal(n, stats.Runs)
+	assertion.Equal(expected.String(), out.String())
+	opts.Dedupe = true
+	out.Reset()
+	stats, err = SortStream(&out, strings.NewReader(many.String()), opts)
+	requirement.Nil(err)
+	assertion.Equal(int64(10), stats.Records)
+	assertion.Equal(first.String(), out.String())
+	entries, err := os.ReadDir(opts.TempDir)
+	requirement.Nil(err)
+	assertion.Empty(entries)
+}
+
+func TestSortFile(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "big.tsv")
+	var data strings.Builder
+	data.WriteString("key\tvalue\r\n")
+	keys := rand.New(rand.NewSource(1)).Perm(5000)
+	for i, key := range keys {
+		fmt.Fprintf(&data, "%d\t%d\r\n", key%2500, i)
+	}
+	requirement.Nil(os.WriteFile(srcFile, []byte(data.String()), os.ModePerm))
+
+	opts := SortOptions{Keys: []SortKey{{Name: "key", Numeric: true}}, Dedupe: true, MemoryLimit: 16 << 10, TempDir: testDir}
+	stats, err := SortFile(srcFile, srcFile, opts)
+	requirement.Nil(err)
+	assertion.Equal(int64(2500), stats.Records)
+	assertion.Equal(int64(2500), stats.Duplicates)
+	assertion.Greater(stats.Runs, 1)
+
+	b, err := os.ReadFile(srcFile)
+	requirement.Nil(err)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\r\n"), "\r\n")
+	requirement.Len(lines, 2501)
+	assertion.Equal("key\tvalue", lines[0])
+	first := make(map[int]int)
+	for i, key := range keys {
+		if _, ok := first[key%2500]; !ok {
+			first[key%2500] = i
+		}
+	}
+	assertion.True(sort.SliceIsSorted(lines[1:], func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.Split(lines[1+i], "\t")[0])
+		b, _ := strconv.Atoi(strings.Split(lines[1+j], "\t")[0])
+		return a < b
+	}))
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		key, _ := strconv.Atoi(fields[0])
+		assertion.Equal(strconv.Itoa(first[key]), fields[1], "first record of key %d", key)
+	}
+	entries, err := os.ReadDir(testDir)
+	requirement.Nil(err)
+	assertion.Len(entries, 1)
+	requirement.Nil(os.RemoveAll(testDir))
+}
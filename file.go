@@ -132,3 +132,118 @@ func UnZip(zip, dst string) error {
 func Zip(src, zip string) error {
 	return fileutil.Zip(src, zip)
 }
+
+/* RewriteOptions configures RewriteFile. */
+type RewriteOptions struct {
+	/* KeepTimes restores the modification time of the file, its access time is set to the same. */
+	KeepTimes bool
+	/* Backup keeps the original file as filePath.bak, replacing an older backup. */
+	Backup bool
+}
+
+/*
+RewriteFile streams the file through rewrite into a temporary file of the same directory, syncs it and renames it
+over the file, so a failure leaves the original untouched. The mode with its setuid, setgid and sticky bits and,
+when permitted, the owner and group are kept. A symbolic link is followed and its target rewritten.
+The error of rewrite is returned as is, rewrite wraps its own errors.
+*/
+func RewriteFile(filePath string, opts RewriteOptions, rewrite func(r io.Reader, w io.Writer) error) error {
+	target, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return wrapError(err)
+	}
+	src, err := os.Open(target)
+	if err != nil {
+		return wrapError(err)
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return wrapError(err)
+	}
+
+	dir, base := filepath.Split(target)
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return wrapError(err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriterSize(tmp, 64*1024)
+	if err = rewrite(src, w); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return wrapError(err)
+	}
+	/* chown clears the setuid and setgid bits, so it comes first. */
+	if err = chownLike(tmp, stat); err != nil {
+		return wrapError(err)
+	}
+	if err = tmp.Chmod(stat.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+		return wrapError(err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return wrapError(err)
+	}
+	if err = tmp.Close(); err != nil {
+		return wrapError(err)
+	}
+	src.Close()
+	if opts.KeepTimes {
+		if err = os.Chtimes(tmp.Name(), stat.ModTime(), stat.ModTime()); err != nil {
+			return wrapError(err)
+		}
+	}
+	if opts.Backup {
+		if err = backupFile(target); err != nil {
+			return wrapError(err)
+		}
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return wrapError(err)
+	}
+	syncDir(dir)
+	return nil
+}
+
+/* rewriteOptions returns the first of the optional RewriteOptions of an in-place helper, the zero value when none is given. */
+func rewriteOptions(opts []RewriteOptions) RewriteOptions {
+	if len(opts) == 0 {
+		return RewriteOptions{}
+	}
+	return opts[0]
+}
+
+/* backupFile links the file as file.bak, or copies it with its mode when the file system has no hard links. */
+func backupFile(filePath string) error {
+	bak := filePath + ".bak"
+	if err := os.Remove(bak); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.Link(filePath, bak) == nil {
+		return nil
+	}
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if err = CopyFile(filePath, bak); err != nil {
+		return err
+	}
+	return os.Chmod(bak, stat.Mode().Perm())
+}
+
+/* syncDir flushes the directory entry of a rename, file systems that can't sync a directory are ignored. */
+func syncDir(dir string) {
+	if dir == "" {
+		dir = "."
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	_ = d.Sync()
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package utils
+
+import (
+	"io/fs"
+	"os"
+)
+
+/* chownLike is a no-op where files have no Unix owner. */
+func chownLike(*os.File, fs.FileInfo) error {
+	return nil
+}
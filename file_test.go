@@ -2,13 +2,17 @@ package utils
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -174,3 +178,79 @@ func TestZipAndUnZip(t *testing.T) {
 	assertion.Equal(rawSrcData, newSrcData)
 	requirement.Nil(os.RemoveAll(testDir))
 }
+
+func TestRewriteFile(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	file := filepath.Join(testDir, "data.txt")
+	requirement.Nil(os.WriteFile(file, []byte("a,b\n"), 0o640))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	requirement.Nil(os.Chtimes(file, mtime, mtime))
+	upper := func(r io.Reader, w io.Writer) error {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bytes.ToUpper(b))
+		return err
+	}
+
+	requirement.Nil(RewriteFile(file, RewriteOptions{KeepTimes: true, Backup: true}, upper))
+	got, err := os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("A,B\n", string(got))
+	stat, err := os.Stat(file)
+	requirement.Nil(err)
+	assertion.Equal(os.FileMode(0o640), stat.Mode().Perm())
+	assertion.True(mtime.Equal(stat.ModTime()))
+	bak, err := os.ReadFile(file + ".bak")
+	requirement.Nil(err)
+	assertion.Equal("a,b\n", string(bak))
+
+	link := filepath.Join(testDir, "link.txt")
+	requirement.Nil(os.Symlink("data.txt", link))
+	requirement.Nil(RewriteFile(link, RewriteOptions{}, func(r io.Reader, w io.Writer) error {
+		_, err := io.WriteString(w, "c,d\n")
+		return err
+	}))
+	info, err := os.Lstat(link)
+	requirement.Nil(err)
+	assertion.True(info.Mode()&fs.ModeSymlink != 0)
+	got, err = os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("c,d\n", string(got))
+
+	err = RewriteFile(file, RewriteOptions{}, func(r io.Reader, w io.Writer) error {
+		_, _ = io.WriteString(w, "partial")
+		return errors.New("broken")
+	})
+	assertion.EqualError(err, "broken")
+	got, err = os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("c,d\n", string(got))
+	entries, err := os.ReadDir(testDir)
+	requirement.Nil(err)
+	assertion.Len(entries, 3)
+
+	/* The setuid and setgid bits are kept and the in-place helpers take the options. */
+	requirement.Nil(os.WriteFile(file, []byte("e\x00f\n"), 0o640))
+	requirement.Nil(os.Chmod(file, 0o750|os.ModeSetuid|os.ModeSetgid))
+	requirement.Nil(os.Chtimes(file, mtime, mtime))
+	requirement.Nil(RemoveNullByteInFile(file, RewriteOptions{KeepTimes: true, Backup: true}))
+	stat, err = os.Stat(file)
+	requirement.Nil(err)
+	assertion.Equal(0o750|os.ModeSetuid|os.ModeSetgid, stat.Mode())
+	assertion.True(mtime.Equal(stat.ModTime()))
+	bak, err = os.ReadFile(file + ".bak")
+	requirement.Nil(err)
+	assertion.Equal("e\x00f\n", string(bak))
+	requirement.Nil(ReplaceDelimiterWithOptions(file, "f", "g", DelimiterOptions{Rewrite: RewriteOptions{Backup: true}}))
+	bak, err = os.ReadFile(file + ".bak")
+	requirement.Nil(err)
+	assertion.Equal("ef\n", string(bak))
+	err = ConvertLineEndings(file, "x", RewriteOptions{Backup: true})
+	assertion.ErrorContains(err, "invalid line ending")
+	assertion.NotContains(err.Error(), "utils: utils:")
+	requirement.Nil(os.RemoveAll(testDir))
+}
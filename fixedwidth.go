@@ -0,0 +1,382 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/* The trim modes of a FixedWidthColumn, both sides are trimmed when Trim is empty. */
+const (
+	FixedWidthTrimBoth  = "both"
+	FixedWidthTrimLeft  = "left"
+	FixedWidthTrimRight = "right"
+	FixedWidthTrimNone  = "none"
+)
+
+/* The kinds of FixedWidthIssue. */
+const (
+	FixedWidthShort   = "short"
+	FixedWidthLong    = "long"
+	FixedWidthInvalid = "invalid"
+)
+
+/*
+FixedWidthColumn describes a field of a fixed-width record, Start is the 1-based position of its first character
+and Width its number of characters. Type is one of the Parquet column types, UTF8 when empty.
+*/
+type FixedWidthColumn struct {
+	Name  string `json:"name"`
+	Start int    `json:"start"`
+	Width int    `json:"width"`
+	Trim  string `json:"trim"`
+	Type  string `json:"type"`
+}
+
+/* FixedWidthSpec describes the records of a fixed-width file, SkipLines leading lines like a banner are ignored. */
+type FixedWidthSpec struct {
+	Columns   []FixedWidthColumn `json:"columns"`
+	SkipLines int                `json:"skip_lines"`
+}
+
+/*
+FixedWidthOptions configures ConvertFixedWidth.
+
+Ext selects the output: .jsonl for JSON Lines, otherwise delimited text by Delimiter, or by the extension when it is 0.
+ConvertFixedWidth takes it from the destination file when it is empty. NoHeader leaves out the header row of the text.
+SkipBadLines leaves out the lines too short or too long for the spec, they are reported either way.
+MaxIssues limits the issues kept in the report, 1000 by default and all of them when negative.
+*/
+type FixedWidthOptions struct {
+	Ext          string
+	Delimiter    rune
+	NoHeader     bool
+	SkipBadLines bool
+	MaxIssues    int
+}
+
+/*
+FixedWidthIssue reports a line too short or too long for the spec with its length in characters,
+or a value of Column which is not of the column type.
+*/
+type FixedWidthIssue struct {
+	Line   int64
+	Kind   string
+	Length int
+	Column string
+}
+
+/* FixedWidthReport counts the converted records and the issues of a conversion, Issues holds the first of them. */
+type FixedWidthReport struct {
+	Records int64
+	Short   int64
+	Long    int64
+	Invalid int64
+	Issues  []FixedWidthIssue
+}
+
+/* LoadFixedWidthSpec parses the JSON spec and checks its columns. */
+func LoadFixedWidthSpec(data []byte) (FixedWidthSpec, error) {
+	var spec FixedWidthSpec
+	if err := JSONUnmarshal(data, &spec); err != nil {
+		return spec, wrapError(err)
+	}
+	return spec, spec.validate()
+}
+
+/* LoadFixedWidthSpecFile reads the JSON spec from the file. */
+func LoadFixedWidthSpecFile(filePath string) (FixedWidthSpec, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return FixedWidthSpec{}, wrapError(err)
+	}
+	return LoadFixedWidthSpec(data)
+}
+
+/*
+ConvertFixedWidth converts the fixed-width file to CSV, TSV or JSON Lines as the options say.
+Fields are cut by character, typed values are normalized with dates in ISO-8601 and blank lines are ignored.
+*/
+func ConvertFixedWidth(srcFile, dstFile string, spec FixedWidthSpec, opts FixedWidthOptions) (FixedWidthReport, error) {
+	f, err := os.Open(srcFile)
+	if err != nil {
+		return FixedWidthReport{}, wrapError(err)
+	}
+	defer f.Close()
+	if opts.Ext == "" {
+		opts.Ext = filepath.Ext(dstFile)
+	}
+	var report FixedWidthReport
+	err = writePartFile(dstFile, func(w io.Writer) error {
+		var err error
+		report, err = ConvertFixedWidthStream(w, f, spec, opts)
+		return err
+	})
+	return report, err
+}
+
+/* ConvertFixedWidthStream converts the fixed-width records of src to dst like ConvertFixedWidth, CSV when Ext is empty. */
+func ConvertFixedWidthStream(dst io.Writer, src io.Reader, spec FixedWidthSpec, opts FixedWidthOptions) (FixedWidthReport, error) {
+	var report FixedWidthReport
+	if err := spec.validate(); err != nil {
+		return report, err
+	}
+	if opts.MaxIssues == 0 {
+		opts.MaxIssues = 1000
+	}
+	addIssue := func(issue FixedWidthIssue) {
+		if opts.MaxIssues < 0 || len(report.Issues) < opts.MaxIssues {
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	buf := bufio.NewWriter(dst)
+	write, flush, err := fixedWidthWriter(buf, spec.Columns, opts)
+	if err != nil {
+		return report, wrapError(err)
+	}
+	var length int
+	for _, column := range spec.Columns {
+		if end := column.Start + column.Width - 1; end > length {
+			length = end
+		}
+	}
+
+	reader := bufio.NewReaderSize(src, 64*1024)
+	values := make([]any, len(spec.Columns))
+	texts := make([]string, len(spec.Columns))
+	var runes []rune
+	for n := int64(1); ; n++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return report, wrapError(err)
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if n <= int64(spec.SkipLines) || line == "" {
+			continue
+		}
+
+		size := utf8.RuneCountInString(line)
+		switch {
+		case size < length:
+			report.Short++
+			addIssue(FixedWidthIssue{Line: n, Kind: FixedWidthShort, Length: size})
+		case size > length:
+			report.Long++
+			addIssue(FixedWidthIssue{Line: n, Kind: FixedWidthLong, Length: size})
+		}
+		if size != length && opts.SkipBadLines {
+			continue
+		}
+		if size != len(line) {
+			runes = runes[:0]
+			for s := line; s != ""; {
+				r, n := utf8.DecodeRuneInString(s)
+				runes = append(runes, r)
+				s = s[n:]
+			}
+		}
+		for i, column := range spec.Columns {
+			var field string
+			if size == len(line) {
+				field = cutField(line, column.Start, column.Width)
+			} else {
+				field = string(cutRunes(runes, column.Start, column.Width))
+			}
+			field = column.trim(field)
+			value, text, err := column.parse(field)
+			if err != nil {
+				report.Invalid++
+				addIssue(FixedWidthIssue{Line: n, Kind: FixedWidthInvalid, Length: size, Column: column.Name})
+				value, text = nil, field
+			}
+			values[i], texts[i] = value, text
+		}
+		if err = write(values, texts); err != nil {
+			return report, wrapError(err)
+		}
+		report.Records++
+	}
+	if err = flush(); err != nil {
+		return report, wrapError(err)
+	}
+	if err = buf.Flush(); err != nil {
+		return report, wrapError(err)
+	}
+	return report, nil
+}
+
+/* validate checks every column has a unique name, a position, a width, a known trim mode and a known type. */
+func (spec FixedWidthSpec) validate() error {
+	if len(spec.Columns) == 0 {
+		return wrapError(errors.New("fixed-width spec has no columns"))
+	}
+	used := make(map[string]bool)
+	for i, column := range spec.Columns {
+		switch {
+		case column.Name == "":
+			return wrapError(fmt.Errorf("fixed-width column %d has no name", i+1))
+		case used[column.Name]:
+			return wrapError(fmt.Errorf("fixed-width column %q is duplicated", column.Name))
+		case column.Start < 1 || column.Width < 1:
+			return wrapError(fmt.Errorf("fixed-width column %q needs a start and a width of at least 1", column.Name))
+		}
+		switch column.Trim {
+		case "", FixedWidthTrimBoth, FixedWidthTrimLeft, FixedWidthTrimRight, FixedWidthTrimNone:
+		default:
+			return wrapError(fmt.Errorf("fixed-width column %q has an unknown trim %q", column.Name, column.Trim))
+		}
+		switch column.Type {
+		case "", ParquetUTF8, ParquetInt64, ParquetDouble, ParquetBoolean, ParquetDate, ParquetTimestamp:
+		default:
+			return wrapError(fmt.Errorf("fixed-width column %q has an unknown type %q", column.Name, column.Type))
+		}
+		used[column.Name] = true
+	}
+	return nil
+}
+
+/* trim removes the spaces the trim mode of the column asks for. */
+func (column FixedWidthColumn) trim(s string) string {
+	switch column.Trim {
+	case FixedWidthTrimNone:
+		return s
+	case FixedWidthTrimLeft:
+		return strings.TrimLeft(s, " ")
+	case FixedWidthTrimRight:
+		return strings.TrimRight(s, " ")
+	}
+	return strings.Trim(s, " ")
+}
+
+/* fixedWidthDateLayouts are the layouts of the DATE and TIMESTAMP columns, the compact ones of mainframe feeds first. */
+var fixedWidthDateLayouts = append([]string{"20060102", "20060102150405"}, excelDateLayouts...)
+
+/*
+parse returns the value of the field for the column type and its text, nil and "" when the field is empty.
+Booleans accept Y and N besides the strconv.ParseBool forms, doubles must be finite.
+*/
+func (column FixedWidthColumn) parse(s string) (any, string, error) {
+	if s == "" {
+		return nil, "", nil
+	}
+	switch column.Type {
+	case ParquetInt64:
+		v, err := strconv.ParseInt(s, 10, 64)
+		return v, strconv.FormatInt(v, 10), err
+	case ParquetDouble:
+		v, err := strconv.ParseFloat(s, 64)
+		if err == nil && (math.IsNaN(v) || math.IsInf(v, 0)) {
+			err = fmt.Errorf("parsing double %q: not a finite number", s)
+		}
+		return v, strconv.FormatFloat(v, 'f', -1, 64), err
+	case ParquetBoolean:
+		var v bool
+		var err error
+		switch strings.ToLower(s) {
+		case "y", "yes":
+			v = true
+		case "n", "no":
+		default:
+			v, err = strconv.ParseBool(s)
+		}
+		return v, strconv.FormatBool(v), err
+	case ParquetDate, ParquetTimestamp:
+		for _, layout := range fixedWidthDateLayouts {
+			t, err := time.Parse(layout, s)
+			if err != nil {
+				continue
+			}
+			text := t.Format("2006-01-02T15:04:05")
+			switch {
+			case column.Type == ParquetDate:
+				text = t.Format("2006-01-02")
+			case strings.Contains(layout, "Z07:00"):
+				text = t.Format(time.RFC3339Nano)
+			}
+			return text, text, nil
+		}
+		return nil, "", fmt.Errorf("parsing %s %q: invalid syntax", strings.ToLower(column.Type), s)
+	}
+	return s, s, nil
+}
+
+/* cutField returns the characters of the ASCII line from the 1-based start, fewer when the line ends first. */
+func cutField(line string, start, width int) string {
+	if start > len(line) {
+		return ""
+	}
+	end := start - 1 + width
+	if end > len(line) {
+		end = len(line)
+	}
+	return line[start-1 : end]
+}
+
+/* cutRunes is cutField for a line of any characters. */
+func cutRunes(line []rune, start, width int) []rune {
+	if start > len(line) {
+		return nil
+	}
+	end := start - 1 + width
+	if end > len(line) {
+		end = len(line)
+	}
+	return line[start-1 : end]
+}
+
+/* fixedWidthWriter returns the functions writing a record as JSON Lines or delimited text, and flushing the output. */
+func fixedWidthWriter(w io.Writer, columns []FixedWidthColumn, opts FixedWidthOptions) (func([]any, []string) error, func() error, error) {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+
+	switch strings.ToLower(opts.Ext) {
+	case ".jsonl", ".ndjson":
+		keys, err := jsonKeys(names)
+		if err != nil {
+			return nil, nil, err
+		}
+		var line []byte
+		write := func(values []any, _ []string) error {
+			if line, err = appendJSONObject(line[:0], keys, values, false); err != nil {
+				return err
+			}
+			_, err := w.Write(append(line, '\n'))
+			return err
+		}
+		return write, func() error { return nil }, nil
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = opts.Delimiter
+	if writer.Comma == 0 {
+		writer.Comma = delimiterByExt("." + strings.TrimPrefix(opts.Ext, "."))
+	}
+	if !opts.NoHeader {
+		if err := writer.Write(names); err != nil {
+			return nil, nil, err
+		}
+	}
+	write := func(_ []any, texts []string) error {
+		return writer.Write(texts)
+	}
+	flush := func() error {
+		writer.Flush()
+		return writer.Error()
+	}
+	return write, flush, nil
+}
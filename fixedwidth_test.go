@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFixedWidthSpec = `{
+	"skip_lines": 1,
+	"columns": [
+		{"name": "account", "start": 1, "width": 6, "trim": "none"},
+		{"name": "name", "start": 7, "width": 10},
+		{"name": "amount", "start": 17, "width": 8, "type": "DOUBLE"},
+		{"name": "date", "start": 25, "width": 8, "type": "DATE"},
+		{"name": "active", "start": 33, "width": 1, "type": "BOOLEAN"}
+	]
+}`
+
+var testFixedWidthData = strings.Join([]string{
+	"HEADER 2023-06-30",
+	"000123Zoë       00012.5020230630Y",
+	"000124Bob       -0000003",
+	"",
+	"000125Al        00000001",
+	"000126Alice     0000010020230630YEXTRA",
+	"000127Eve       abc     20230631N",
+}, "\r\n") + "\r\n"
+
+func TestConvertFixedWidth(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	spec, err := LoadFixedWidthSpec([]byte(testFixedWidthSpec))
+	requirement.Nil(err)
+	requirement.Len(spec.Columns, 5)
+
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "feed.dat")
+	requirement.Nil(os.WriteFile(srcFile, []byte(testFixedWidthData), os.ModePerm))
+
+	testCases := []struct {
+		name     string
+		dstFile  string
+		opts     FixedWidthOptions
+		expected string
+		records  int64
+	}{
+		{
+			"CSV", "feed.csv", FixedWidthOptions{},
+			"account,name,amount,date,active\n" +
+				"000123,Zoë,12.5,2023-06-30,true\n" +
+				"000124,Bob,-3,,\n" +
+				"000125,Al,1,,\n" +
+				"000126,Alice,100,2023-06-30,true\n" +
+				"000127,Eve,abc,20230631,false\n",
+			5,
+		},
+		{
+			"TSV", "feed.tsv", FixedWidthOptions{NoHeader: true, SkipBadLines: true},
+			"000123\tZoë\t12.5\t2023-06-30\ttrue\n" +
+				"000127\tEve\tabc\t20230631\tfalse\n",
+			2,
+		},
+		{
+			"JSONL", "feed.jsonl", FixedWidthOptions{SkipBadLines: true},
+			`{"account":"000123","name":"Zoë","amount":12.5,"date":"2023-06-30","active":true}` + "\n" +
+				`{"account":"000127","name":"Eve","amount":null,"date":null,"active":false}` + "\n",
+			2,
+		},
+	}
+	for _, testCase := range testCases {
+		dstFile := filepath.Join(testDir, testCase.dstFile)
+		report, err := ConvertFixedWidth(srcFile, dstFile, spec, testCase.opts)
+		requirement.Nil(err, testCase.name)
+		got, err := os.ReadFile(dstFile)
+		requirement.Nil(err)
+		assertion.Equal(testCase.expected, string(got), testCase.name)
+		assertion.Equal(testCase.records, report.Records, testCase.name)
+		assertion.Equal(int64(2), report.Short, testCase.name)
+		assertion.Equal(int64(1), report.Long, testCase.name)
+	}
+
+	report, err := ConvertFixedWidthStream(new(bytes.Buffer), strings.NewReader(testFixedWidthData), spec, FixedWidthOptions{MaxIssues: -1})
+	requirement.Nil(err)
+	assertion.Equal([]FixedWidthIssue{
+		{Line: 3, Kind: FixedWidthShort, Length: 24},
+		{Line: 5, Kind: FixedWidthShort, Length: 24},
+		{Line: 6, Kind: FixedWidthLong, Length: 38},
+		{Line: 7, Kind: FixedWidthInvalid, Length: 33, Column: "amount"},
+		{Line: 7, Kind: FixedWidthInvalid, Length: 33, Column: "date"},
+	}, report.Issues)
+	assertion.Equal(int64(2), report.Invalid)
+	report, err = ConvertFixedWidthStream(new(bytes.Buffer), strings.NewReader(testFixedWidthData), spec, FixedWidthOptions{MaxIssues: 1})
+	requirement.Nil(err)
+	assertion.Len(report.Issues, 1)
+
+	/* NaN and Inf are invalid doubles, not values JSON can't hold. */
+	var out bytes.Buffer
+	doubles := FixedWidthSpec{Columns: []FixedWidthColumn{{Name: "x", Start: 1, Width: 4, Type: ParquetDouble}}}
+	report, err = ConvertFixedWidthStream(&out, strings.NewReader("1.5 \nNaN \n+Inf\n"), doubles, FixedWidthOptions{Ext: ".jsonl"})
+	requirement.Nil(err)
+	assertion.Equal(`{"x":1.5}`+"\n"+`{"x":null}`+"\n"+`{"x":null}`+"\n", out.String())
+	assertion.Equal([]FixedWidthIssue{
+		{Line: 2, Kind: FixedWidthInvalid, Length: 4, Column: "x"},
+		{Line: 3, Kind: FixedWidthInvalid, Length: 4, Column: "x"},
+	}, report.Issues)
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestLoadFixedWidthSpec(t *testing.T) {
+	assertion := assert.New(t)
+	testCases := []struct {
+		name     string
+		spec     string
+		expected string
+	}{
+		{"Empty", `{"columns": []}`, "no columns"},
+		{"Name", `{"columns": [{"start": 1, "width": 2}]}`, "has no name"},
+		{"Duplicate", `{"columns": [{"name": "a", "start": 1, "width": 2}, {"name": "a", "start": 3, "width": 2}]}`, "duplicated"},
+		{"Width", `{"columns": [{"name": "a", "start": 1}]}`, "width of at least 1"},
+		{"Trim", `{"columns": [{"name": "a", "start": 1, "width": 2, "trim": "middle"}]}`, "unknown trim"},
+		{"Type", `{"columns": [{"name": "a", "start": 1, "width": 2, "type": "MONEY"}]}`, "unknown type"},
+		{"JSON", `{"columns": [`, ""},
+	}
+	for _, testCase := range testCases {
+		_, err := LoadFixedWidthSpec([]byte(testCase.spec))
+		assertion.ErrorContains(err, testCase.expected, testCase.name)
+	}
+}
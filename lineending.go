@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/text/transform"
+)
+
+/* LineEndings counts the CRLF, LF and bare CR line endings of a text. */
+type LineEndings struct {
+	CRLF int64
+	LF   int64
+	CR   int64
+}
+
+/* Dominant returns the most frequent line ending, LF when there is none. */
+func (e LineEndings) Dominant() string {
+	switch {
+	case e.CRLF > e.LF && e.CRLF >= e.CR:
+		return LineEndingCRLF
+	case e.CR > e.LF && e.CR > e.CRLF:
+		return LineEndingCR
+	}
+	return LineEndingLF
+}
+
+/* Mixed reports whether the text uses more than one line ending. */
+func (e LineEndings) Mixed() bool {
+	var styles int
+	for _, n := range []int64{e.CRLF, e.LF, e.CR} {
+		if n > 0 {
+			styles++
+		}
+	}
+	return styles > 1
+}
+
+/* CountLineEndings counts the line endings of r, reading it in chunks. */
+func CountLineEndings(r io.Reader) (LineEndings, error) {
+	var e LineEndings
+	buf := make([]byte, 64*1024)
+	pendingCR := false
+	for {
+		n, err := r.Read(buf)
+		chunk := buf[:n]
+		if pendingCR && n > 0 {
+			if chunk[0] == '\n' {
+				e.CRLF++
+				chunk = chunk[1:]
+			} else {
+				e.CR++
+			}
+			pendingCR = false
+		}
+		if len(chunk) > 0 && chunk[len(chunk)-1] == '\r' {
+			pendingCR = true
+			chunk = chunk[:len(chunk)-1]
+		}
+		crlf := int64(bytes.Count(chunk, []byte("\r\n")))
+		e.CRLF += crlf
+		e.CR += int64(bytes.Count(chunk, []byte{'\r'})) - crlf
+		e.LF += int64(bytes.Count(chunk, []byte{'\n'})) - crlf
+		if err == io.EOF {
+			if pendingCR {
+				e.CR++
+			}
+			return e, nil
+		}
+		if err != nil {
+			return e, wrapError(err)
+		}
+	}
+}
+
+/* CountFileLineEndings counts the line endings of the file. */
+func CountFileLineEndings(filePath string) (LineEndings, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return LineEndings{}, wrapError(err)
+	}
+	defer f.Close()
+	return CountLineEndings(f)
+}
+
+/* NewLineEndingReader returns a reader converting every CRLF, LF and bare CR of r to eol, in constant memory. */
+func NewLineEndingReader(r io.Reader, eol string) (io.Reader, error) {
+	t, err := newLineEndingTransformer(eol, false)
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewReader(r, t), nil
+}
+
+/* ConvertLineEndings converts every line ending of the file to eol, the file is streamed and rewritten as opts say. */
+func ConvertLineEndings(filePath, eol string, opts ...RewriteOptions) error {
+	t, err := newLineEndingTransformer(eol, false)
+	if err != nil {
+		return err
+	}
+	return rewriteLineEndings(filePath, t, rewriteOptions(opts))
+}
+
+/* ReplaceDosToUnix replaces the Windows end of line(eol) with the Unix eol in the filePath, bare CR are kept. */
+func ReplaceDosToUnix(filePath string, opts ...RewriteOptions) error {
+	t, err := newLineEndingTransformer(LineEndingLF, true)
+	if err != nil {
+		return err
+	}
+	return rewriteLineEndings(filePath, t, rewriteOptions(opts))
+}
+
+/* rewriteLineEndings streams the file through the line ending transformer in place. */
+func rewriteLineEndings(filePath string, t transform.Transformer, opts RewriteOptions) error {
+	return RewriteFile(filePath, opts, func(r io.Reader, w io.Writer) error {
+		if _, err := io.Copy(w, transform.NewReader(r, t)); err != nil {
+			return wrapError(err)
+		}
+		return nil
+	})
+}
+
+/* lineEndingTransformer rewrites the line endings to eol, only the CRLF ones when onlyCRLF is set. */
+type lineEndingTransformer struct {
+	transform.NopResetter
+	eol      []byte
+	onlyCRLF bool
+}
+
+/* newLineEndingTransformer checks eol is one of LineEndingLF, LineEndingCRLF and LineEndingCR. */
+func newLineEndingTransformer(eol string, onlyCRLF bool) (lineEndingTransformer, error) {
+	switch eol {
+	case LineEndingLF, LineEndingCRLF, LineEndingCR:
+		return lineEndingTransformer{eol: []byte(eol), onlyCRLF: onlyCRLF}, nil
+	}
+	return lineEndingTransformer{}, wrapError(fmt.Errorf("invalid line ending %q", eol))
+}
+
+func (t lineEndingTransformer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		run := bytes.IndexAny(src[nSrc:], "\r\n")
+		if run < 0 {
+			run = len(src) - nSrc
+		}
+		if run > 0 {
+			n := copy(dst[nDst:], src[nSrc:nSrc+run])
+			nDst += n
+			nSrc += n
+			if n < run {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			continue
+		}
+
+		size := 1
+		if src[nSrc] == '\r' {
+			if nSrc+1 == len(src) && !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			if nSrc+1 < len(src) && src[nSrc+1] == '\n' {
+				size = 2
+			}
+		}
+		eol := t.eol
+		if t.onlyCRLF && size == 1 {
+			eol = src[nSrc : nSrc+1]
+		}
+		if len(dst)-nDst < len(eol) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], eol)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
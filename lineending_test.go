@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountLineEndings(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	testCases := []struct {
+		name     string
+		data     string
+		expected LineEndings
+		dominant string
+		mixed    bool
+	}{
+		{"empty", "", LineEndings{}, LineEndingLF, false},
+		{"unix", "a\nb\n", LineEndings{LF: 2}, LineEndingLF, false},
+		{"dos", "a\r\nb\r\nc", LineEndings{CRLF: 2}, LineEndingCRLF, false},
+		{"mac", "a\rb\rc\r", LineEndings{CR: 3}, LineEndingCR, false},
+		{"mixed", "a\r\nb\nc\r\nd\re\r", LineEndings{CRLF: 2, LF: 1, CR: 2}, LineEndingCRLF, true},
+	}
+	for _, testCase := range testCases {
+		/* One byte reads split every CRLF across reads. */
+		got, err := CountLineEndings(iotest.OneByteReader(strings.NewReader(testCase.data)))
+		requirement.Nil(err)
+		assertion.Equal(testCase.expected, got, testCase.name)
+		assertion.Equal(testCase.dominant, got.Dominant(), testCase.name)
+		assertion.Equal(testCase.mixed, got.Mixed(), testCase.name)
+	}
+}
+
+func TestLineEndingReader(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	data := "a\r\nb\nc\rd\r"
+	testCases := []struct {
+		eol      string
+		expected string
+	}{
+		{LineEndingLF, "a\nb\nc\nd\n"},
+		{LineEndingCRLF, "a\r\nb\r\nc\r\nd\r\n"},
+		{LineEndingCR, "a\rb\rc\rd\r"},
+	}
+	for _, testCase := range testCases {
+		r, err := NewLineEndingReader(iotest.OneByteReader(strings.NewReader(data)), testCase.eol)
+		requirement.Nil(err)
+		got, err := io.ReadAll(r)
+		requirement.Nil(err)
+		assertion.Equal(testCase.expected, string(got), "%q", testCase.eol)
+	}
+
+	long := strings.Repeat("0123456789abcde\r\n", 10000)
+	r, err := NewLineEndingReader(strings.NewReader(long), LineEndingLF)
+	requirement.Nil(err)
+	got, err := io.ReadAll(r)
+	requirement.Nil(err)
+	assertion.Equal(strings.ReplaceAll(long, "\r\n", "\n"), string(got))
+
+	_, err = NewLineEndingReader(strings.NewReader(data), "\n\n")
+	assertion.ErrorContains(err, "invalid line ending")
+}
+
+func TestConvertLineEndings(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	file := filepath.Join(testDir, "mac.txt")
+	requirement.Nil(os.WriteFile(file, []byte("a\rb\rc"), 0o640))
+
+	requirement.Nil(ConvertLineEndings(file, LineEndingCRLF))
+	got, err := os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("a\r\nb\r\nc", string(got))
+	stat, err := os.Stat(file)
+	requirement.Nil(err)
+	assertion.Equal(os.FileMode(0o640), stat.Mode().Perm())
+
+	requirement.Nil(os.WriteFile(file, []byte("a\r\nb\rc\n"), 0o640))
+	requirement.Nil(ReplaceDosToUnix(file))
+	got, err = os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("a\nb\rc\n", string(got))
+	requirement.Nil(os.RemoveAll(testDir))
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+/*
+byteSet is a set of bytes to drop, a single byte is searched with bytes.IndexByte
+and ASCII bytes with bytes.IndexAny.
+*/
+type byteSet struct {
+	drop  [256]bool
+	only  int
+	ascii string
+}
+
+/* newByteSet returns the set of the given bytes, the NUL byte when none is given. */
+func newByteSet(drop ...byte) *byteSet {
+	if len(drop) == 0 {
+		drop = []byte{0}
+	}
+	s := &byteSet{only: -1}
+	ascii := true
+	for _, b := range drop {
+		s.drop[b] = true
+		ascii = ascii && b < utf8.RuneSelf
+	}
+	if len(drop) == 1 {
+		s.only = int(drop[0])
+	} else if ascii {
+		s.ascii = string(drop)
+	}
+	return s
+}
+
+/* index returns the index of the first byte of p in the set, -1 when there is none. */
+func (s *byteSet) index(p []byte) int {
+	switch {
+	case s.only >= 0:
+		return bytes.IndexByte(p, byte(s.only))
+	case s.ascii != "":
+		return bytes.IndexAny(p, s.ascii)
+	}
+	for i, b := range p {
+		if s.drop[b] {
+			return i
+		}
+	}
+	return -1
+}
+
+/* filter moves the kept bytes of p to its front a span at a time and returns their count. */
+func (s *byteSet) filter(p []byte) int {
+	i := s.index(p)
+	if i < 0 {
+		return len(p)
+	}
+	n := i
+	for i++; i < len(p); {
+		j := s.index(p[i:])
+		if j < 0 {
+			j = len(p) - i
+		}
+		n += copy(p[n:], p[i:i+j])
+		i += j + 1
+	}
+	return n
+}
+
+/* byteFilterReader drops the bytes of a set from the underlying reader. */
+type byteFilterReader struct {
+	r   io.Reader
+	set *byteSet
+}
+
+/* NewByteFilterReader returns a reader dropping the given bytes from r on the fly, the NUL byte when none is given. */
+func NewByteFilterReader(r io.Reader, drop ...byte) io.Reader {
+	return &byteFilterReader{r: r, set: newByteSet(drop...)}
+}
+
+func (f *byteFilterReader) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+		n = f.set.filter(p[:n])
+		if n > 0 || err != nil || len(p) == 0 {
+			return n, err
+		}
+	}
+}
+
+/* NullByteScan reports the offset of the first NUL byte of an input, -1 when there is none, and their count. */
+type NullByteScan struct {
+	First int64
+	Count int64
+}
+
+/* ScanNullBytes reads r to the end and reports its NUL bytes. */
+func ScanNullBytes(r io.Reader) (NullByteScan, error) {
+	return scanNullBytes(r, false)
+}
+
+/* ScanFileNullBytes reads the file and reports its NUL bytes. */
+func ScanFileNullBytes(filePath string) (NullByteScan, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return NullByteScan{First: -1}, wrapError(err)
+	}
+	defer f.Close()
+	return scanNullBytes(f, false)
+}
+
+/* scanNullBytes scans r in chunks, stops at the first NUL byte when firstOnly is set. */
+func scanNullBytes(r io.Reader, firstOnly bool) (NullByteScan, error) {
+	scan := NullByteScan{First: -1}
+	buf := make([]byte, 64*1024)
+	var offset int64
+	for {
+		n, err := r.Read(buf)
+		chunk := buf[:n]
+		if scan.First < 0 {
+			if i := bytes.IndexByte(chunk, 0); i >= 0 {
+				scan.First = offset + int64(i)
+				if firstOnly {
+					scan.Count = 1
+					return scan, nil
+				}
+			}
+		}
+		if scan.First >= 0 {
+			scan.Count += int64(bytes.Count(chunk, []byte{0}))
+		}
+		offset += int64(n)
+		if err == io.EOF {
+			return scan, nil
+		}
+		if err != nil {
+			return scan, wrapError(err)
+		}
+	}
+}
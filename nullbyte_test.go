@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestByteFilterReader(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	testCases := []struct {
+		name     string
+		data     string
+		drop     []byte
+		expected string
+	}{
+		{"none", "abc", nil, "abc"},
+		{"nul", "\x00a\x00\x00b\x00", nil, "ab"},
+		{"only nul", "\x00\x00\x00", nil, ""},
+		{"single", "a\x1fb\x1f", []byte{0x1f}, "ab"},
+		{"set", "a\x00b\x1ac\x7fd\x00", []byte{0, 0x1a, 0x7f}, "abcd"},
+		{"run", "\x00\x1a\x00ab\x1a\x1a\x00", []byte{0, 0x1a}, "ab"},
+		{"high", "a\xffb\xfe\x00c\xc3\xa9", []byte{0, 0xfe, 0xff}, "abc\xc3\xa9"},
+	}
+	for _, testCase := range testCases {
+		for _, r := range []io.Reader{
+			strings.NewReader(testCase.data),
+			iotest.OneByteReader(strings.NewReader(testCase.data)),
+		} {
+			got, err := io.ReadAll(NewByteFilterReader(r, testCase.drop...))
+			requirement.Nil(err)
+			assertion.Equal(testCase.expected, string(got), testCase.name)
+		}
+	}
+
+	data := bytes.Repeat([]byte("abc\x00def\x00\x00"), 20000)
+	got, err := io.ReadAll(NewByteFilterReader(bytes.NewReader(data)))
+	requirement.Nil(err)
+	assertion.Equal(bytes.ReplaceAll(data, []byte{0}, nil), got)
+	got, err = io.ReadAll(NewByteFilterReader(bytes.NewReader(data), 0, 'e'))
+	requirement.Nil(err)
+	assertion.Equal(bytes.Repeat([]byte("abcdf"), 20000), got)
+}
+
+func TestScanNullBytes(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	testCases := []struct {
+		name     string
+		data     string
+		expected NullByteScan
+	}{
+		{"empty", "", NullByteScan{First: -1}},
+		{"none", "abc", NullByteScan{First: -1}},
+		{"some", "ab\x00c\x00\x00", NullByteScan{First: 2, Count: 3}},
+	}
+	for _, testCase := range testCases {
+		got, err := ScanNullBytes(iotest.OneByteReader(strings.NewReader(testCase.data)))
+		requirement.Nil(err)
+		assertion.Equal(testCase.expected, got, testCase.name)
+	}
+
+	_, err := ScanNullBytes(iotest.ErrReader(errors.New("broken")))
+	assertion.ErrorContains(err, "broken")
+
+	createDir(testDir)
+	file := filepath.Join(testDir, "nul.txt")
+	requirement.Nil(os.WriteFile(file, append(bytes.Repeat([]byte{'a'}, 100000), 0), 0o640))
+	got, err := ScanFileNullBytes(file)
+	requirement.Nil(err)
+	assertion.Equal(NullByteScan{First: 100000, Count: 1}, got)
+	_, err = ScanFileNullBytes(filepath.Join(testDir, "missing.txt"))
+	assertion.NotNil(err)
+	requirement.Nil(os.RemoveAll(testDir))
+}
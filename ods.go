@@ -0,0 +1,503 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/* odsMimeType is the content of the mimetype entry of an OpenDocument spreadsheet package. */
+const odsMimeType = "application/vnd.oasis.opendocument.spreadsheet"
+
+/* odsHeadSize is how many leading bytes isODS needs, the package stores its mimetype entry first. */
+const odsHeadSize = 30 + len("mimetype") + len(odsMimeType) + 32
+
+/* isODS reports whether the head of the file is an OpenDocument spreadsheet package. */
+func isODS(head []byte) bool {
+	if !bytes.HasPrefix(head, []byte("PK\x03\x04")) || len(head) < 38 || string(head[30:38]) != "mimetype" {
+		return false
+	}
+	if len(head) > odsHeadSize {
+		head = head[:odsHeadSize]
+	}
+	return bytes.Contains(head[38:], []byte(odsMimeType))
+}
+
+/*
+odsBook is an OpenDocument spreadsheet, every sheet is a table of content.xml
+streamed by its own pass over the part.
+*/
+type odsBook struct {
+	reader *zip.Reader
+	closer io.Closer
+	names  []string
+	hidden map[string]bool
+}
+
+/* odsSource returns the excelSource opening the OpenDocument spreadsheet package. */
+func odsSource(open func() (*zip.Reader, io.Closer, error)) excelSource {
+	return func(ExcelOptions) (spreadsheet, error) {
+		reader, closer, err := open()
+		if err != nil {
+			return nil, err
+		}
+		book := &odsBook{reader: reader, closer: closer, hidden: make(map[string]bool)}
+		if err = book.readTables(); err != nil {
+			closer.Close()
+			return nil, wrapError(err)
+		}
+		return book, nil
+	}
+}
+
+/* readTables collects the table names of content.xml and the tables whose style hides them. */
+func (b *odsBook) readTables() error {
+	r, err := b.reader.Open("content.xml")
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	hiddenStyles := make(map[string]bool)
+	var style string
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "style":
+			style = ""
+			if odsAttr(start, "family") == "table" {
+				style = odsAttr(start, "name")
+			}
+		case "table-properties":
+			if style != "" && odsAttr(start, "display") == "false" {
+				hiddenStyles[style] = true
+			}
+		case "table":
+			name := odsAttr(start, "name")
+			b.names = append(b.names, name)
+			b.hidden[name] = hiddenStyles[odsAttr(start, "style-name")]
+			if err = decoder.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (b *odsBook) sheets() []string {
+	return b.names
+}
+
+func (b *odsBook) visible(sheet string) (bool, error) {
+	for _, name := range b.names {
+		if name == sheet {
+			return !b.hidden[sheet], nil
+		}
+	}
+	return false, fmt.Errorf("sheet %s does not exist", sheet)
+}
+
+/*
+rows returns a function reading the rows of the table until io.EOF and a function releasing them.
+Repeated rows and columns are expanded, trailing empty rows and cells are dropped.
+*/
+func (b *odsBook) rows(sheet string, opts ExcelOptions) (func() ([]string, error), func(), error) {
+	r, err := b.reader.Open("content.xml")
+	if err != nil {
+		return nil, nil, err
+	}
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			r.Close()
+			if err == io.EOF {
+				err = fmt.Errorf("sheet %s does not exist", sheet)
+			}
+			return nil, nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "table" {
+			if odsAttr(start, "name") == sheet {
+				break
+			}
+			if err = decoder.Skip(); err != nil {
+				r.Close()
+				return nil, nil, err
+			}
+		}
+	}
+	rows := &odsRows{decoder: decoder, opts: opts}
+	return rows.next, func() {
+		if err := r.Close(); err != nil {
+			printError(err)
+		}
+	}, nil
+}
+
+func (b *odsBook) close() {
+	if err := b.closer.Close(); err != nil {
+		printError(err)
+	}
+}
+
+/* odsSpan is a range of spanned cells, the covered cells repeat value when FillMerged is set. */
+type odsSpan struct {
+	firstRow, lastRow int
+	firstCol, lastCol int
+	value             string
+}
+
+/* odsRows reads the rows of a table, decoder is positioned inside the table element. */
+type odsRows struct {
+	decoder  *xml.Decoder
+	opts     ExcelOptions
+	physical int
+	blank    int
+	row      []string
+	count    int
+	spans    []odsSpan
+}
+
+/* next returns the next row, blank rows are only returned when a row with values follows them. */
+func (r *odsRows) next() ([]string, error) {
+	for r.count == 0 {
+		row, count, err := r.readRow()
+		if err != nil {
+			return nil, err
+		}
+		if len(row) == 0 {
+			r.blank += count
+			continue
+		}
+		r.row, r.count = row, count
+	}
+	if r.blank > 0 {
+		r.blank--
+		return nil, nil
+	}
+	r.count--
+	return r.row, nil
+}
+
+/* readRow decodes the next table-row and how many times it repeats, io.EOF once the table ends. */
+func (r *odsRows) readRow() ([]string, int, error) {
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, 0, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table-header-rows", "table-row-group", "table-rows":
+			case "table-row":
+				return r.decodeRow(t)
+			default:
+				if err = r.decoder.Skip(); err != nil {
+					return nil, 0, err
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "table" {
+				return nil, 0, io.EOF
+			}
+		}
+	}
+}
+
+/* decodeRow decodes the cells of the table-row, runs of empty cells are only expanded when a value follows them. */
+func (r *odsRows) decodeRow(start xml.StartElement) ([]string, int, error) {
+	count := odsIntAttr(start, "number-rows-repeated")
+	n := r.physical + 1
+	r.physical += count
+	live := r.spans[:0]
+	for _, span := range r.spans {
+		if span.lastRow >= n {
+			live = append(live, span)
+		}
+	}
+	r.spans = live
+
+	var row []string
+	var col, empty int
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return nil, 0, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "table-cell" && t.Name.Local != "covered-table-cell" {
+				if err = r.decoder.Skip(); err != nil {
+					return nil, 0, err
+				}
+				continue
+			}
+			cell, err := decodeODSCell(r.decoder, t)
+			if err != nil {
+				return nil, 0, err
+			}
+			values := make([]string, 0, 1)
+			switch {
+			case t.Name.Local == "table-cell":
+				value := cell.render(r.opts)
+				if r.opts.FillMerged && (cell.rowSpan > 1 || cell.colSpan > 1) {
+					r.spans = append(r.spans, odsSpan{n, n + cell.rowSpan - 1, col, col + cell.colSpan - 1, value})
+				}
+				if value != "" {
+					values = append(values, value)
+				}
+			case r.opts.FillMerged && len(r.spans) != 0:
+				for i := 0; i < cell.repeat; i++ {
+					values = append(values, r.spanValue(n, col+i))
+				}
+			}
+			if len(values) == 0 {
+				empty += cell.repeat
+				col += cell.repeat
+				continue
+			}
+			for ; empty > 0; empty-- {
+				row = append(row, "")
+			}
+			for i := 0; i < cell.repeat; i++ {
+				row = append(row, values[i%len(values)])
+			}
+			col += cell.repeat
+		case xml.EndElement:
+			for len(row) != 0 && row[len(row)-1] == "" {
+				row = row[:len(row)-1]
+			}
+			return row, count, nil
+		}
+	}
+}
+
+/* spanValue returns the value of the span covering the cell, or "". */
+func (r *odsRows) spanValue(row, col int) string {
+	for _, span := range r.spans {
+		if span.firstRow <= row && row <= span.lastRow && span.firstCol <= col && col <= span.lastCol {
+			return span.value
+		}
+	}
+	return ""
+}
+
+/* odsCell holds the attributes and the paragraphs of a table-cell. */
+type odsCell struct {
+	repeat    int
+	rowSpan   int
+	colSpan   int
+	valueType string
+	value     string
+	formula   string
+	text      string
+	hasText   bool
+}
+
+/* decodeODSCell decodes the cell until its end element, annotations are skipped. */
+func decodeODSCell(decoder *xml.Decoder, start xml.StartElement) (odsCell, error) {
+	cell := odsCell{
+		repeat:    odsIntAttr(start, "number-columns-repeated"),
+		rowSpan:   odsIntAttr(start, "number-rows-spanned"),
+		colSpan:   odsIntAttr(start, "number-columns-spanned"),
+		valueType: odsAttr(start, "value-type"),
+		formula:   odsAttr(start, "formula"),
+	}
+	switch cell.valueType {
+	case "date":
+		cell.value = odsAttr(start, "date-value")
+	case "time":
+		cell.value = odsAttr(start, "time-value")
+	case "boolean":
+		cell.value = odsAttr(start, "boolean-value")
+	case "string":
+		cell.value = odsAttr(start, "string-value")
+	default:
+		cell.value = odsAttr(start, "value")
+	}
+
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return cell, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "p" && t.Name.Local != "h" {
+				if err = decoder.Skip(); err != nil {
+					return cell, err
+				}
+				continue
+			}
+			if cell.hasText {
+				text.WriteByte('\n')
+			}
+			cell.hasText = true
+			if err = odsText(decoder, &text); err != nil {
+				return cell, err
+			}
+		case xml.EndElement:
+			cell.text = text.String()
+			return cell, nil
+		}
+	}
+}
+
+/*
+render returns the text of the cell shaped by the options: formula text, ISO-8601 dates and times
+or the typed value instead of the displayed paragraphs.
+*/
+func (c odsCell) render(opts ExcelOptions) string {
+	if opts.FormulaText && c.formula != "" {
+		return odsFormula(c.formula)
+	}
+	if opts.ISODates && c.value != "" {
+		switch c.valueType {
+		case "date":
+			return c.value
+		case "time":
+			return odsTime(c.value)
+		}
+	}
+	if (opts.RawCellValue || !c.hasText) && c.value != "" {
+		return c.value
+	}
+	return c.text
+}
+
+/* odsText appends the text of the element until its end, text:s, text:tab and text:line-break are expanded. */
+func odsText(decoder *xml.Decoder, text *strings.Builder) error {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "s":
+				text.WriteString(strings.Repeat(" ", odsIntAttr(t, "c")))
+			case "tab":
+				text.WriteByte('\t')
+			case "line-break":
+				text.WriteByte('\n')
+			case "annotation", "note":
+				if err = decoder.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = odsText(decoder, text); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+/* odsTime converts an ISO-8601 duration like PT08H30M00S to 08:30:00, other values are returned unchanged. */
+func odsTime(value string) string {
+	rest, ok := strings.CutPrefix(value, "PT")
+	if !ok {
+		return value
+	}
+	var parts [3]string
+	for i, unit := range []string{"H", "M", "S"} {
+		var found bool
+		if parts[i], rest, found = strings.Cut(rest, unit); !found {
+			return value
+		}
+	}
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil || rest != "" {
+		return value
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, int(seconds))
+}
+
+/*
+odsFormula converts an OpenFormula like of:=SUM([.A1:.A2])+[$Data.B1] to the Excel notation =SUM(A1:A2)+Data!B1.
+String literals are copied unchanged.
+*/
+func odsFormula(formula string) string {
+	if i := strings.Index(formula, ":="); i >= 0 && !strings.ContainsAny(formula[:i], "\"[(") {
+		formula = formula[i+1:]
+	}
+	var res strings.Builder
+	var quoted bool
+	for i := 0; i < len(formula); i++ {
+		ch := formula[i]
+		switch {
+		case ch == '"':
+			quoted = !quoted
+			res.WriteByte(ch)
+		case ch == '[' && !quoted:
+			end := strings.IndexByte(formula[i:], ']')
+			if end < 0 {
+				res.WriteString(formula[i:])
+				return res.String()
+			}
+			for j, ref := range strings.Split(formula[i+1:i+end], ":") {
+				if j > 0 {
+					res.WriteByte(':')
+				}
+				if ref, ok := strings.CutPrefix(ref, "."); ok {
+					res.WriteString(ref)
+					continue
+				}
+				ref = strings.TrimPrefix(ref, "$")
+				if dot := strings.LastIndexByte(ref, '.'); dot >= 0 {
+					ref = ref[:dot] + "!" + ref[dot+1:]
+				}
+				res.WriteString(ref)
+			}
+			i += end
+		default:
+			res.WriteByte(ch)
+		}
+	}
+	return res.String()
+}
+
+/* odsAttr returns the value of the attribute by its local name. */
+func odsAttr(start xml.StartElement, local string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+/* odsIntAttr returns the count held by the attribute, 1 when it is missing or invalid. */
+func odsIntAttr(start xml.StartElement, local string) int {
+	n, err := strconv.Atoi(odsAttr(start, local))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
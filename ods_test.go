@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testODSContent = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+ xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0"
+ xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+ xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" office:version="1.2">
+<office:automatic-styles>
+<style:style style:name="ta1" style:family="table"><style:table-properties table:display="true"/></style:style>
+<style:style style:name="ta2" style:family="table"><style:table-properties table:display="false"/></style:style>
+</office:automatic-styles>
+<office:body><office:spreadsheet>
+<table:table table:name="Data" table:style-name="ta1">
+<table:table-column table:number-columns-repeated="3"/>
+<table:table-header-rows><table:table-row>
+<table:table-cell office:value-type="string"><text:p>name</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>amount</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>day</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>at</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>ok</text:p></table:table-cell>
+</table:table-row></table:table-header-rows>
+<table:table-row table:number-rows-repeated="2">
+<table:table-cell office:value-type="string"><text:p>a<text:s text:c="2"/>b</text:p><office:annotation><text:p>note</text:p></office:annotation></table:table-cell>
+<table:table-cell office:value-type="float" office:value="1234.5"><text:p>1,234.50</text:p></table:table-cell>
+<table:table-cell office:value-type="date" office:date-value="2023-07-01"><text:p>07/01/23</text:p></table:table-cell>
+<table:table-cell office:value-type="time" office:time-value="PT08H30M00S"><text:p>08:30 AM</text:p></table:table-cell>
+<table:table-cell office:value-type="boolean" office:boolean-value="true"><text:p>TRUE</text:p></table:table-cell>
+<table:table-cell table:number-columns-repeated="1019"/>
+</table:table-row>
+<table:table-row table:number-rows-repeated="3"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+<table:table-row>
+<table:table-cell table:number-columns-spanned="2" table:number-rows-spanned="2" office:value-type="string"><text:p>span</text:p><text:p>two</text:p></table:table-cell>
+<table:covered-table-cell/>
+<table:table-cell table:number-columns-repeated="2"/>
+<table:table-cell table:formula="of:=SUM([.B2:.B3])+[$Data.B2]" office:value-type="float" office:value="3703.5"><text:p>3703.5</text:p></table:table-cell>
+</table:table-row>
+<table:table-row><table:covered-table-cell table:number-columns-repeated="2"/><table:table-cell office:value-type="percentage" office:value="0.25"><text:p>25%</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="1048570"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+</table:table>
+<table:table table:name="Hidden" table:style-name="ta2">
+<table:table-row><table:table-cell office:value-type="string"><text:p>secret</text:p></table:table-cell></table:table-row>
+</table:table>
+</office:spreadsheet></office:body></office:document-content>`
+
+func writeTestODS(w io.Writer, content string) error {
+	zw := zip.NewWriter(w)
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err = mimetype.Write([]byte(odsMimeType)); err != nil {
+		return err
+	}
+	part, err := zw.Create("content.xml")
+	if err != nil {
+		return err
+	}
+	if _, err = part.Write([]byte(content)); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func TestConvertODS(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "partner.ods")
+	var data bytes.Buffer
+	requirement.Nil(writeTestODS(&data, testODSContent))
+	requirement.Nil(os.WriteFile(srcFile, data.Bytes(), os.ModePerm))
+	assertion.True(isODS(data.Bytes()))
+
+	testCases := []struct {
+		name     string
+		opts     ExcelOptions
+		expected string
+	}{
+		{
+			name: "Default",
+			opts: ExcelOptions{SkipHidden: true},
+			expected: "name,amount,day,at,ok\n" +
+				"a  b,\"1,234.50\",07/01/23,08:30 AM,TRUE\n" +
+				"a  b,\"1,234.50\",07/01/23,08:30 AM,TRUE\n" +
+				"\n\n\n" +
+				"\"span\ntwo\",,,,3703.5\n" +
+				",,25%\n",
+		},
+		{
+			name: "Typed",
+			opts: ExcelOptions{SkipHidden: true, RawCellValue: true, ISODates: true, FillMerged: true, FormulaText: true},
+			expected: "name,amount,day,at,ok\n" +
+				"a  b,1234.5,2023-07-01,08:30:00,true\n" +
+				"a  b,1234.5,2023-07-01,08:30:00,true\n" +
+				"\n\n\n" +
+				"\"span\ntwo\",\"span\ntwo\",,,=SUM(B2:B3)+Data!B2\n" +
+				"\"span\ntwo\",\"span\ntwo\",0.25\n",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(*testing.T) {
+			files, err := ConvertExcelWithOptions(srcFile, testCase.opts)
+			requirement.Nil(err)
+			requirement.Equal([]string{filepath.Join(testDir, "partner_Data.csv")}, files)
+			got, err := os.ReadFile(files[0])
+			requirement.Nil(err)
+			assertion.Equal(testCase.expected, string(got))
+		})
+	}
+
+	buf := new(sheetBuffer)
+	sheets, err := ConvertExcelReaderToJSONL(bytes.NewReader(data.Bytes()), JSONLOptions{ExcelOptions: ExcelOptions{IncludeSheets: []string{"Hidden"}}}, func(string) (io.WriteCloser, error) {
+		return buf, nil
+	})
+	requirement.Nil(err)
+	assertion.Equal([]string{"Hidden"}, sheets)
+	assertion.Equal("", buf.String())
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestODSFormula(t *testing.T) {
+	assertion := assert.New(t)
+	testCases := []struct {
+		formula  string
+		expected string
+	}{
+		{"of:=SUM([.A1:.A2])", "=SUM(A1:A2)"},
+		{"of:=[$'My Sheet'.$B$1]*2", "='My Sheet'!$B$1*2"},
+		{`of:=IF([.A1]="[.x]";1;0)`, `=IF(A1="[.x]";1;0)`},
+		{"=A1", "=A1"},
+	}
+	for _, testCase := range testCases {
+		assertion.Equal(testCase.expected, odsFormula(testCase.formula), testCase.formula)
+	}
+	assertion.Equal("08:30:15", odsTime("PT08H30M15.5S"))
+	assertion.Equal("P1D", odsTime("P1D"))
+}
@@ -0,0 +1,597 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/marshal"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/types"
+)
+
+/* The column types InferParquetSchema can produce. */
+const (
+	ParquetInt64     = "INT64"
+	ParquetDouble    = "DOUBLE"
+	ParquetBoolean   = "BOOLEAN"
+	ParquetDate      = "DATE"
+	ParquetTimestamp = "TIMESTAMP"
+	ParquetUTF8      = "UTF8"
+)
+
+/* ParquetColumn describes a column of an inferred Parquet schema. */
+type ParquetColumn struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+/*
+ParquetOptions configures ConvertTextToParquet and ConvertExcelToParquet.
+
+Delimiter is chosen by the file extension when it is 0, Sheet defaults to the first sheet
+and Password opens an encrypted workbook.
+SampleRows limits how many rows are inspected to infer the schema, 1000 by default and all rows when negative.
+Types overrides the inferred type of the named columns, Nullable makes every column optional.
+*/
+type ParquetOptions struct {
+	Delimiter  rune
+	Sheet      string
+	SampleRows int
+	Types      map[string]string
+	Nullable   bool
+	Password   string
+}
+
+/* ConvertTextToParquet converts the delimited text file with a header row to the Parquet file, returns the inferred schema. */
+func ConvertTextToParquet(srcFile, dstFile string, opts ParquetOptions) ([]ParquetColumn, error) {
+	f, err := os.Open(srcFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if opts.Delimiter == 0 {
+		opts.Delimiter = delimiterByExt(srcFile)
+	}
+	reader := newTextReader(f, opts.Delimiter)
+	reader.ReuseRecord = false
+	return writeParquetRows(dstFile, reader.Read, opts)
+}
+
+/*
+ConvertExcelToParquet converts the sheet with a header row to the Parquet file, returns the inferred schema.
+Cells are read as raw values with dates in ISO-8601, so booleans are 1/0 unless a BOOLEAN type overrides them.
+*/
+func ConvertExcelToParquet(srcFile, dstFile string, opts ParquetOptions) ([]ParquetColumn, error) {
+	src, err := fileExcelSource(srcFile, opts.Password)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	excelOpts := ExcelOptions{RawCellValue: true, ISODates: true}
+	book, err := src(excelOpts)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer book.close()
+
+	if opts.Sheet == "" {
+		if sheets := book.sheets(); len(sheets) != 0 {
+			opts.Sheet = sheets[0]
+		}
+	}
+	next, closeRows, err := book.rows(opts.Sheet, excelOpts)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer closeRows()
+	return writeParquetRows(dstFile, next, opts)
+}
+
+/*
+InferParquetSchema infers the type and nullability of every column from the sample rows.
+A column is the narrowest of INT64, DOUBLE, BOOLEAN, DATE, TIMESTAMP that fits all its values, otherwise UTF8.
+*/
+func InferParquetSchema(header []string, rows [][]string, types map[string]string) []ParquetColumn {
+	names := parquetColumnNames(header)
+	columns := make([]ParquetColumn, len(names))
+	for i, name := range names {
+		fits := map[string]bool{ParquetInt64: true, ParquetDouble: true, ParquetBoolean: true, ParquetDate: true, ParquetTimestamp: true}
+		var values int
+		for _, row := range rows {
+			if i >= len(row) || row[i] == "" {
+				columns[i].Nullable = true
+				continue
+			}
+			values++
+			for typ, ok := range fits {
+				if ok {
+					_, err := parseParquetValue(row[i], typ)
+					fits[typ] = err == nil
+				}
+			}
+		}
+		columns[i].Name = name
+		columns[i].Type = ParquetUTF8
+		if values != 0 {
+			for _, typ := range []string{ParquetInt64, ParquetDouble, ParquetBoolean, ParquetDate, ParquetTimestamp} {
+				if fits[typ] {
+					columns[i].Type = typ
+					break
+				}
+			}
+		}
+		if typ, ok := types[name]; ok {
+			columns[i].Type = strings.ToUpper(typ)
+		}
+	}
+	return columns
+}
+
+/* ParquetSchema returns the JSON schema string of the columns accepted by ParquetWriter. */
+func ParquetSchema(columns []ParquetColumn) (string, error) {
+	type field struct {
+		Tag    string
+		Fields []field `json:",omitempty"`
+	}
+	root := field{Tag: "name=parquet_go_root, repetitiontype=REQUIRED"}
+	for _, column := range columns {
+		var tag string
+		switch column.Type {
+		case ParquetInt64, ParquetDouble, ParquetBoolean:
+			tag = "type=" + column.Type
+		case ParquetDate:
+			tag = "type=INT32, convertedtype=DATE"
+		case ParquetTimestamp:
+			tag = "type=INT64, convertedtype=TIMESTAMP_MILLIS"
+		case ParquetUTF8:
+			tag = "type=BYTE_ARRAY, convertedtype=UTF8"
+		default:
+			return "", wrapError(fmt.Errorf("unsupported parquet type %q of column %s", column.Type, column.Name))
+		}
+		repetition := "REQUIRED"
+		if column.Nullable {
+			repetition = "OPTIONAL"
+		}
+		root.Fields = append(root.Fields, field{Tag: "name=" + column.Name + ", " + tag + ", repetitiontype=" + repetition})
+	}
+	return JSONMarshalString(root)
+}
+
+/*
+writeParquetRows reads the header and the sample rows from next, infers the schema
+and writes every row to dstFile through a .part file, a failure leaves no partial output.
+*/
+func writeParquetRows(dstFile string, next func() ([]string, error), opts ParquetOptions) ([]ParquetColumn, error) {
+	if opts.SampleRows == 0 {
+		opts.SampleRows = 1000
+	}
+	header, err := next()
+	if err != nil {
+		if err == io.EOF {
+			return nil, wrapError(errors.New("missing header row"))
+		}
+		return nil, wrapError(err)
+	}
+	header = append([]string(nil), header...)
+
+	var sample [][]string
+	for opts.SampleRows < 0 || len(sample) < opts.SampleRows {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		sample = append(sample, row)
+	}
+	columns := InferParquetSchema(header, sample, opts.Types)
+	if opts.Nullable {
+		for i := range columns {
+			columns[i].Nullable = true
+		}
+	}
+	schema, err := ParquetSchema(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writePartFile(dstFile, func(w io.Writer) error {
+		pw, err := parquetWriterTo(w, schema)
+		if err != nil {
+			return err
+		}
+		pw.MarshalFunc = marshal.MarshalJSON
+
+		line := 1
+		write := func(row []string) error {
+			line++
+			record := make(map[string]any, len(columns))
+			for i, column := range columns {
+				if i >= len(row) || row[i] == "" {
+					if !column.Nullable {
+						return fmt.Errorf("row %d: column %s is empty but not nullable", line, column.Name)
+					}
+					continue
+				}
+				v, err := parseParquetValue(row[i], column.Type)
+				if err != nil {
+					return fmt.Errorf("row %d: column %s: %w", line, column.Name, err)
+				}
+				record[column.Name] = v
+			}
+			data, err := JSONMarshalString(record)
+			if err != nil {
+				return err
+			}
+			return pw.Write(data)
+		}
+		for _, row := range sample {
+			if err = write(row); err != nil {
+				return err
+			}
+		}
+		for {
+			row, err := next()
+			if err == io.EOF {
+				break
+			}
+			if err == nil {
+				err = write(row)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return pw.WriteStop()
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return columns, nil
+}
+
+/*
+parseParquetValue converts s to the value stored for the column type,
+DATE is the number of days since the Unix epoch and TIMESTAMP the milliseconds.
+*/
+func parseParquetValue(s, typ string) (any, error) {
+	switch typ {
+	case ParquetInt64:
+		if digits := strings.TrimLeft(s, "+-"); len(digits) > 1 && digits[0] == '0' {
+			return nil, fmt.Errorf("parsing int64 %q: leading zero", s)
+		}
+		return strconv.ParseInt(s, 10, 64)
+	case ParquetDouble:
+		if !isNumberLike(s) {
+			return nil, fmt.Errorf("parsing double %q: invalid syntax", s)
+		}
+		return strconv.ParseFloat(s, 64)
+	case ParquetBoolean:
+		switch strings.ToLower(s) {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("parsing boolean %q: invalid syntax", s)
+	case ParquetDate:
+		for _, layout := range excelDateLayouts[:2] {
+			if t, err := time.Parse(layout, s); err == nil {
+				days := t.Unix() / 86400
+				if t.Unix()%86400 < 0 {
+					days--
+				}
+				return days, nil
+			}
+		}
+		return nil, fmt.Errorf("parsing date %q: invalid syntax", s)
+	case ParquetTimestamp:
+		for _, layout := range excelDateLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UnixMilli(), nil
+			}
+		}
+		return nil, fmt.Errorf("parsing timestamp %q: invalid syntax", s)
+	}
+	return s, nil
+}
+
+/*
+parquetColumnNames makes the header usable as schema names, blank and duplicate names are numbered.
+Names are compared without case, as parquet-go capitalises them into its field names.
+*/
+func parquetColumnNames(header []string) []string {
+	names := make([]string, len(header))
+	used := make(map[string]bool)
+	for i, name := range header {
+		name = strings.TrimSpace(strings.NewReplacer(",", "_", "=", "_").Replace(name))
+		if name == "" {
+			name = "column_" + strconv.Itoa(i+1)
+		}
+		unique := name
+		for n := 2; used[strings.ToLower(unique)]; n++ {
+			unique = name + "_" + strconv.Itoa(n)
+		}
+		used[strings.ToLower(unique)] = true
+		names[i] = unique
+	}
+	return names
+}
+
+/* parquetBatchSize is the number of rows read from a Parquet file at a time. */
+const parquetBatchSize = 1024
+
+/*
+ParquetReader opens the file and a ParquetReader capable of reading data in parquet format,
+obj is a object with tags, JSON schema string or nil to use the schema in the file.
+*/
+func ParquetReader(srcFile string, obj any) (source.ParquetFile, *reader.ParquetReader, error) {
+	fr, err := local.NewLocalFileReader(srcFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reader: %w", err)
+	}
+	pr, err := reader.NewParquetReader(fr, obj, 4)
+	if err != nil {
+		fr.Close()
+		return nil, nil, fmt.Errorf("parquet handler: %w", err)
+	}
+	return fr, pr, nil
+}
+
+/* ReadParquet reads all rows of the Parquet file into a slice of T, T is a struct with parquet tags. */
+func ReadParquet[T any](srcFile string) ([]T, error) {
+	var rows []T
+	err := IterateParquet(srcFile, func(row T) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+/* IterateParquet calls fn for every row of the Parquet file in order, stops at the first error returned by fn. */
+func IterateParquet[T any](srcFile string, fn func(T) error) error {
+	fr, pr, err := ParquetReader(srcFile, new(T))
+	if err != nil {
+		return wrapError(err)
+	}
+	defer fr.Close()
+	defer pr.ReadStop()
+
+	rows := make([]T, parquetBatchSize)
+	for remain := pr.GetNumRows(); remain > 0; remain -= int64(len(rows)) {
+		if remain < int64(len(rows)) {
+			rows = rows[:remain]
+		}
+		if err = pr.Read(&rows); err != nil {
+			return wrapError(err)
+		}
+		for _, row := range rows {
+			if err = fn(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/* ConvertParquetToCSV converts the Parquet file to the CSV file with a header row. */
+func ConvertParquetToCSV(srcFile, dstFile string) error {
+	return ConvertParquetToText(srcFile, dstFile, ',')
+}
+
+/* ConvertParquetToTSV converts the Parquet file to the TSV file with a header row. */
+func ConvertParquetToTSV(srcFile, dstFile string) error {
+	return ConvertParquetToText(srcFile, dstFile, '\t')
+}
+
+/*
+ConvertParquetToText converts the Parquet file to the text file by delimiter with a header row.
+Dates and timestamps are written in ISO-8601, nested columns as JSON and nulls as empty fields.
+*/
+func ConvertParquetToText(srcFile, dstFile string, delimiter rune) error {
+	return exportParquet(srcFile, dstFile, func(w io.Writer, columns []parquetField) (func([]any) error, func() error, error) {
+		writer := csv.NewWriter(w)
+		writer.Comma = delimiter
+		header := make([]string, len(columns))
+		for i, column := range columns {
+			header[i] = column.name
+		}
+		if err := writer.Write(header); err != nil {
+			return nil, nil, err
+		}
+		record := make([]string, len(columns))
+		write := func(values []any) error {
+			for i, v := range values {
+				switch v := v.(type) {
+				case nil:
+					record[i] = ""
+				case string:
+					record[i] = v
+				case float32:
+					record[i] = strconv.FormatFloat(float64(v), 'f', -1, 32)
+				case float64:
+					record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+				case bool, int32, int64:
+					record[i] = fmt.Sprint(v)
+				default:
+					data, err := JSONMarshal(v)
+					if err != nil {
+						return err
+					}
+					record[i] = string(data)
+				}
+			}
+			return writer.Write(record)
+		}
+		flush := func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		return write, flush, nil
+	})
+}
+
+/* ConvertParquetToJSONL converts the Parquet file to JSON Lines, one object per row keyed by column name. */
+func ConvertParquetToJSONL(srcFile, dstFile string) error {
+	return exportParquet(srcFile, dstFile, func(w io.Writer, columns []parquetField) (func([]any) error, func() error, error) {
+		names := make([]string, len(columns))
+		for i, column := range columns {
+			names[i] = column.name
+		}
+		keys, err := jsonKeys(names)
+		if err != nil {
+			return nil, nil, err
+		}
+		var line []byte
+		write := func(values []any) error {
+			if line, err = appendJSONObject(line[:0], keys, values, false); err != nil {
+				return err
+			}
+			_, err := w.Write(append(line, '\n'))
+			return err
+		}
+		return write, func() error { return nil }, nil
+	})
+}
+
+/* parquetField is a top-level column of a Parquet file. */
+type parquetField struct {
+	name    string
+	inName  string
+	element *parquet.SchemaElement
+}
+
+/*
+exportParquet reads the Parquet file with the schema stored in it and passes the converted
+values of every row to the writer built by newWriter on dstFile, written through a .part file.
+*/
+func exportParquet(srcFile, dstFile string, newWriter func(io.Writer, []parquetField) (func([]any) error, func() error, error)) error {
+	fr, pr, err := ParquetReader(srcFile, nil)
+	if err != nil {
+		return wrapError(err)
+	}
+	defer fr.Close()
+	defer pr.ReadStop()
+
+	var columns []parquetField
+	elements := pr.SchemaHandler.SchemaElements
+	for i, n := 1, 0; n < int(elements[0].GetNumChildren()); n++ {
+		columns = append(columns, parquetField{
+			name:    pr.SchemaHandler.GetExName(i),
+			inName:  pr.SchemaHandler.GetInName(i),
+			element: elements[i],
+		})
+		i = parquetSubtreeEnd(elements, i)
+	}
+	return writePartFile(dstFile, func(w io.Writer) error {
+		buf := bufio.NewWriter(w)
+		write, flush, err := newWriter(buf, columns)
+		if err != nil {
+			return wrapError(err)
+		}
+
+		values := make([]any, len(columns))
+		for remain := pr.GetNumRows(); remain > 0; remain -= parquetBatchSize {
+			n := parquetBatchSize
+			if remain < parquetBatchSize {
+				n = int(remain)
+			}
+			rows, err := pr.ReadByNumber(n)
+			if err != nil {
+				return wrapError(err)
+			}
+			for _, row := range rows {
+				v := reflect.ValueOf(row)
+				for i, column := range columns {
+					values[i] = parquetValue(v.FieldByName(column.inName), column.element)
+				}
+				if err = write(values); err != nil {
+					return wrapError(err)
+				}
+			}
+		}
+		if err = flush(); err != nil {
+			return wrapError(err)
+		}
+		if err = buf.Flush(); err != nil {
+			return wrapError(err)
+		}
+		return nil
+	})
+}
+
+/* parquetSubtreeEnd returns the index after the schema element i and all its descendants. */
+func parquetSubtreeEnd(elements []*parquet.SchemaElement, i int) int {
+	n := int(elements[i].GetNumChildren())
+	i++
+	for ; n > 0; n-- {
+		i = parquetSubtreeEnd(elements, i)
+	}
+	return i
+}
+
+/* parquetValue converts the stored value of the column to its logical value, nil for null and a slice for a repeated column. */
+func parquetValue(v reflect.Value, element *parquet.SchemaElement) any {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if element.GetNumChildren() != 0 {
+		return v.Interface()
+	}
+	if v.Kind() == reflect.Slice {
+		values := make([]any, v.Len())
+		for i := range values {
+			values[i] = parquetValue(v.Index(i), element)
+		}
+		return values
+	}
+	value := v.Interface()
+	if s, ok := value.(string); ok && element.GetType() == parquet.Type_INT96 {
+		return types.INT96ToTime(s).Format(time.RFC3339Nano)
+	}
+	if !element.IsSetConvertedType() {
+		return value
+	}
+	switch value := value.(type) {
+	case int32:
+		switch element.GetConvertedType() {
+		case parquet.ConvertedType_DATE:
+			return time.Unix(int64(value)*86400, 0).UTC().Format("2006-01-02")
+		case parquet.ConvertedType_DECIMAL:
+			return types.DECIMAL_INT_ToString(int64(value), int(element.GetPrecision()), int(element.GetScale()))
+		}
+	case int64:
+		switch element.GetConvertedType() {
+		case parquet.ConvertedType_TIMESTAMP_MILLIS:
+			return time.UnixMilli(value).UTC().Format(time.RFC3339Nano)
+		case parquet.ConvertedType_TIMESTAMP_MICROS:
+			return time.UnixMicro(value).UTC().Format(time.RFC3339Nano)
+		case parquet.ConvertedType_DECIMAL:
+			return types.DECIMAL_INT_ToString(value, int(element.GetPrecision()), int(element.GetScale()))
+		}
+	case string:
+		if element.GetConvertedType() == parquet.ConvertedType_DECIMAL {
+			return types.DECIMAL_BYTE_ARRAY_ToString([]byte(value), int(element.GetPrecision()), int(element.GetScale()))
+		}
+	}
+	return value
+}
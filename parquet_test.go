@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestInferParquetSchema(t *testing.T) {
+	assertion := assert.New(t)
+	header := []string{"id", "price", "ok", "day", "at", "zip", "", "id"}
+	rows := [][]string{
+		{"1", "9.5", "true", "2023-07-01", "2023-07-01", "00123", "", "x"},
+		{"2", "3", "FALSE", "2023-07-02", "2023-07-01 08:30:00", "10001", "", ""},
+		{"", "-1e3", "false", "2023-07-03"},
+	}
+	expected := []ParquetColumn{
+		{"id", ParquetInt64, true},
+		{"price", ParquetDouble, false},
+		{"ok", ParquetBoolean, false},
+		{"day", ParquetDate, false},
+		{"at", ParquetTimestamp, true},
+		{"zip", ParquetInt64, true},
+		{"column_7", ParquetUTF8, true},
+		{"id_2", ParquetUTF8, true},
+	}
+	columns := InferParquetSchema(header, rows, map[string]string{"zip": "utf8"})
+	expected[5].Type = ParquetUTF8
+	assertion.Equal(expected, columns)
+}
+
+func TestConvertTextToParquet(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "feed.tsv")
+	dstFile := filepath.Join(testDir, "feed.parquet")
+	data := "id\tname\tprice\tday\n1\tapple\t9.5\t2023-07-01\n2\t\t3\t2023-07-02\n3\tkiwi\t0.25\t1970-01-02\n"
+	requirement.Nil(os.WriteFile(srcFile, []byte(data), os.ModePerm))
+
+	columns, err := ConvertTextToParquet(srcFile, dstFile, ParquetOptions{SampleRows: 2})
+	requirement.Nil(err)
+	assertion.Equal([]ParquetColumn{
+		{"id", ParquetInt64, false},
+		{"name", ParquetUTF8, true},
+		{"price", ParquetDouble, false},
+		{"day", ParquetDate, false},
+	}, columns)
+
+	fr, err := local.NewLocalFileReader(dstFile)
+	requirement.Nil(err)
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	requirement.Nil(err)
+	defer pr.ReadStop()
+	assertion.Equal(int64(3), pr.GetNumRows())
+	values, _, _, err := pr.ReadColumnByPath("Parquet_go_root\x01Day", 3)
+	requirement.Nil(err)
+	assertion.Equal([]any{int32(19539), int32(19540), int32(1)}, values)
+	values, _, _, err = pr.ReadColumnByPath("Parquet_go_root\x01Name", 3)
+	requirement.Nil(err)
+	assertion.Equal([]any{"apple", nil, "kiwi"}, values)
+
+	requirement.Nil(os.WriteFile(srcFile, []byte(data+"x\t\t\t\n"), os.ModePerm))
+	requirement.Nil(os.Remove(dstFile))
+	_, err = ConvertTextToParquet(srcFile, dstFile, ParquetOptions{SampleRows: 2})
+	assertion.ErrorContains(err, "row 5")
+	assertion.NoFileExists(dstFile)
+	assertion.NoFileExists(dstFile + ".part")
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestConvertTextToParquetRoundTrip(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "feed.csv")
+	parquetFile := filepath.Join(testDir, "feed.parquet")
+	dstFile := filepath.Join(testDir, "out.csv")
+	data := "name,Name,id,Id,day\nkiwi,Kiwi,1,2,1969-12-31\nfig,Fig,3,4,1900-01-01\n"
+	requirement.Nil(os.WriteFile(srcFile, []byte(data), os.ModePerm))
+
+	columns, err := ConvertTextToParquet(srcFile, parquetFile, ParquetOptions{})
+	requirement.Nil(err)
+	assertion.Equal([]ParquetColumn{
+		{"name", ParquetUTF8, false},
+		{"Name_2", ParquetUTF8, false},
+		{"id", ParquetInt64, false},
+		{"Id_2", ParquetInt64, false},
+		{"day", ParquetDate, false},
+	}, columns)
+	requirement.Nil(ConvertParquetToCSV(parquetFile, dstFile))
+	got, err := os.ReadFile(dstFile)
+	requirement.Nil(err)
+	assertion.Equal("name,Name_2,id,Id_2,day\nkiwi,Kiwi,1,2,1969-12-31\nfig,Fig,3,4,1900-01-01\n", string(got))
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestConvertExcelToParquet(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "feed.xlsx")
+	dstFile := filepath.Join(testDir, "feed.parquet")
+	f := excelize.NewFile()
+	requirement.Nil(f.SetSheetRow("Sheet1", "A1", &[]any{"id", "score", "name", "day"}))
+	requirement.Nil(f.SetSheetRow("Sheet1", "A2", &[]any{1, 0.5, "a", time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)}))
+	requirement.Nil(f.SetSheetRow("Sheet1", "A3", &[]any{2, 1.5, nil, time.Date(2023, 7, 2, 0, 0, 0, 0, time.UTC)}))
+	style, err := f.NewStyle(&excelize.Style{NumFmt: 14})
+	requirement.Nil(err)
+	requirement.Nil(f.SetCellStyle("Sheet1", "D2", "D3", style))
+	requirement.Nil(f.SaveAs(srcFile))
+	requirement.Nil(f.Close())
+
+	columns, err := ConvertExcelToParquet(srcFile, dstFile, ParquetOptions{Types: map[string]string{"id": ParquetDouble}})
+	requirement.Nil(err)
+	assertion.Equal([]ParquetColumn{
+		{"id", ParquetDouble, false},
+		{"score", ParquetDouble, false},
+		{"name", ParquetUTF8, true},
+		{"day", ParquetDate, false},
+	}, columns)
+	requirement.FileExists(dstFile)
+
+	/* Excel booleans are read as 1/0, a BOOLEAN override stores them as booleans. */
+	f = excelize.NewFile()
+	requirement.Nil(f.SetSheetRow("Sheet1", "A1", &[]any{"ok"}))
+	requirement.Nil(f.SetSheetRow("Sheet1", "A2", &[]any{true}))
+	requirement.Nil(f.SetSheetRow("Sheet1", "A3", &[]any{false}))
+	requirement.Nil(f.SaveAs(srcFile))
+	requirement.Nil(f.Close())
+	columns, err = ConvertExcelToParquet(srcFile, dstFile, ParquetOptions{})
+	requirement.Nil(err)
+	assertion.Equal([]ParquetColumn{{"ok", ParquetInt64, false}}, columns)
+	columns, err = ConvertExcelToParquet(srcFile, dstFile, ParquetOptions{Types: map[string]string{"ok": ParquetBoolean}})
+	requirement.Nil(err)
+	assertion.Equal([]ParquetColumn{{"ok", ParquetBoolean, false}}, columns)
+	fr, err := local.NewLocalFileReader(dstFile)
+	requirement.Nil(err)
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	requirement.Nil(err)
+	values, _, _, err := pr.ReadColumnByPath("Parquet_go_root\x01Ok", 2)
+	requirement.Nil(err)
+	assertion.Equal([]any{true, false}, values)
+	pr.ReadStop()
+	requirement.Nil(fr.Close())
+
+	f = excelize.NewFile()
+	requirement.Nil(f.SetSheetRow("Sheet1", "A1", &[]any{"id"}))
+	requirement.Nil(f.SetSheetRow("Sheet1", "A2", &[]any{1}))
+	requirement.Nil(f.SaveAs(srcFile, excelize.Options{Password: "s3cret"}))
+	requirement.Nil(f.Close())
+	_, err = ConvertExcelToParquet(srcFile, dstFile, ParquetOptions{})
+	assertion.ErrorIs(err, excelize.ErrWorkbookPassword)
+	columns, err = ConvertExcelToParquet(srcFile, dstFile, ParquetOptions{Password: "s3cret"})
+	requirement.Nil(err)
+	assertion.Equal([]ParquetColumn{{"id", ParquetInt64, false}}, columns)
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestReadParquet(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	type record struct {
+		ID    int64   `parquet:"name=id, type=INT64"`
+		Name  string  `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+		Score float64 `parquet:"name=score, type=DOUBLE"`
+	}
+	file := filepath.Join(testDir, "records.parquet")
+	fw, pw, err := ParquetWriter(file, new(record))
+	requirement.Nil(err)
+	var expected []record
+	for i := 0; i < 2500; i++ {
+		expected = append(expected, record{ID: int64(i), Name: "n" + strconv.Itoa(i), Score: float64(i) / 4})
+		requirement.Nil(pw.Write(expected[i]))
+	}
+	requirement.Nil(pw.WriteStop())
+	requirement.Nil(fw.Close())
+
+	got, err := ReadParquet[record](file)
+	requirement.Nil(err)
+	assertion.Equal(expected, got)
+
+	var n int
+	stop := errors.New("stop")
+	err = IterateParquet(file, func(r record) error {
+		n++
+		if r.ID == 9 {
+			return stop
+		}
+		return nil
+	})
+	assertion.ErrorIs(err, stop)
+	assertion.Equal(10, n)
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestConvertParquetToText(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "feed.csv")
+	parquetFile := filepath.Join(testDir, "feed.parquet")
+	data := "id,name,price,day,at\n1,\"a, b\",9.5,2023-07-01,2023-07-01 08:30:00\n2,,3,2023-07-02,\n"
+	requirement.Nil(os.WriteFile(srcFile, []byte(data), os.ModePerm))
+	_, err := ConvertTextToParquet(srcFile, parquetFile, ParquetOptions{})
+	requirement.Nil(err)
+
+	testCases := []struct {
+		name     string
+		convert  func(string, string) error
+		expected string
+	}{
+		{".csv", ConvertParquetToCSV, "id,name,price,day,at\n1,\"a, b\",9.5,2023-07-01,2023-07-01T08:30:00Z\n2,,3,2023-07-02,\n"},
+		{".tsv", ConvertParquetToTSV, "id\tname\tprice\tday\tat\n1\ta, b\t9.5\t2023-07-01\t2023-07-01T08:30:00Z\n2\t\t3\t2023-07-02\t\n"},
+		{".jsonl", ConvertParquetToJSONL, `{"id":1,"name":"a, b","price":9.5,"day":"2023-07-01","at":"2023-07-01T08:30:00Z"}` + "\n" +
+			`{"id":2,"name":null,"price":3,"day":"2023-07-02","at":null}` + "\n"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(*testing.T) {
+			dstFile := filepath.Join(testDir, "out"+testCase.name)
+			requirement.Nil(testCase.convert(parquetFile, dstFile))
+			got, err := os.ReadFile(dstFile)
+			requirement.Nil(err)
+			assertion.Equal(testCase.expected, string(got))
+		})
+	}
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestConvertParquetRepeated(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	type record struct {
+		ID   int64   `parquet:"name=id, type=INT64"`
+		Days []int32 `parquet:"name=days, type=INT32, convertedtype=DATE, repetitiontype=REPEATED"`
+	}
+	srcFile := filepath.Join(testDir, "repeated.parquet")
+	dstFile := filepath.Join(testDir, "repeated.csv")
+	fw, pw, err := ParquetWriter(srcFile, new(record))
+	requirement.Nil(err)
+	requirement.Nil(pw.Write(record{ID: 1, Days: []int32{0, 19539}}))
+	requirement.Nil(pw.Write(record{ID: 2}))
+	requirement.Nil(pw.WriteStop())
+	requirement.Nil(fw.Close())
+
+	requirement.Nil(ConvertParquetToCSV(srcFile, dstFile))
+	got, err := os.ReadFile(dstFile)
+	requirement.Nil(err)
+	assertion.Equal("id,days\n1,\"[\"\"1970-01-01\"\",\"\"2023-07-01\"\"]\"\n2,[]\n", string(got))
+	partFiles, err := filepath.Glob(filepath.Join(testDir, "*.part"))
+	requirement.Nil(err)
+	assertion.Empty(partFiles)
+	requirement.Nil(os.RemoveAll(testDir))
+}
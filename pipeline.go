@@ -0,0 +1,269 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"golang.org/x/text/transform"
+)
+
+/*
+Pipeline chains text transforms applied to a stream in a single pass, in the order they are added.
+The first invalid transform is reported by Reader, Writer, Copy and RewriteFile.
+*/
+type Pipeline struct {
+	links []func() transform.Transformer
+	err   error
+}
+
+/* NewPipeline returns an empty pipeline, which copies its input unchanged. */
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+/* Then adds a custom transform, it is shared by the streams of the pipeline and reset for each of them. */
+func (p *Pipeline) Then(t transform.Transformer) *Pipeline {
+	return p.add(func() transform.Transformer { return t })
+}
+
+/* RemoveBytes drops the given bytes, the NUL byte when none is given. */
+func (p *Pipeline) RemoveBytes(drop ...byte) *Pipeline {
+	set := newByteSet(drop...)
+	return p.add(func() transform.Transformer { return byteSetTransformer{set: set} })
+}
+
+/* NormalizeLineEndings converts every CRLF, LF and bare CR to eol. */
+func (p *Pipeline) NormalizeLineEndings(eol string) *Pipeline {
+	t, err := newLineEndingTransformer(eol, false)
+	if err != nil {
+		return p.fail(err)
+	}
+	return p.add(func() transform.Transformer { return t })
+}
+
+/* ReplaceDelimiter replaces the old delimiter with the new one, both are read like ReplaceDelimiterWithOptions reads them. */
+func (p *Pipeline) ReplaceDelimiter(old, new string) *Pipeline {
+	newBytes, err := ConvertStringToCharByte(new)
+	if err != nil {
+		return p.fail(wrapError(err))
+	}
+	t := literalReplacer{old: delimiterBytes(old), new: newBytes}
+	if len(t.old) == 0 {
+		return p.fail(wrapError(errors.New("empty delimiter")))
+	}
+	return p.add(func() transform.Transformer { return t })
+}
+
+/* TrimTrailingSpace removes the spaces and tabs ending a line or the input. */
+func (p *Pipeline) TrimTrailingSpace() *Pipeline {
+	return p.add(func() transform.Transformer { return &trailingSpaceTrimmer{} })
+}
+
+/* ReplaceInvalidUTF8 replaces every byte which is not part of a valid UTF-8 sequence with U+FFFD. */
+func (p *Pipeline) ReplaceInvalidUTF8() *Pipeline {
+	return p.add(func() transform.Transformer { return &utf8Repairer{mode: UTF8Replace} })
+}
+
+/* DeleteInvalidUTF8 drops every byte which is not part of a valid UTF-8 sequence. */
+func (p *Pipeline) DeleteInvalidUTF8() *Pipeline {
+	return p.add(func() transform.Transformer { return &utf8Repairer{mode: UTF8Delete} })
+}
+
+/* StripControl drops the ASCII control characters but the given ones, tab, LF and CR when none is given. */
+func (p *Pipeline) StripControl(keep ...byte) *Pipeline {
+	if len(keep) == 0 {
+		keep = []byte{'\t', '\n', '\r'}
+	}
+	var drop []byte
+	for b := byte(0); b <= 0x7f; b++ {
+		if (b < 0x20 || b == 0x7f) && bytes.IndexByte(keep, b) < 0 {
+			drop = append(drop, b)
+		}
+	}
+	if len(drop) == 0 {
+		return p
+	}
+	return p.RemoveBytes(drop...)
+}
+
+/* Transformer returns the transforms of the pipeline chained into one. */
+func (p *Pipeline) Transformer() (transform.Transformer, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(p.links) == 0 {
+		return transform.Nop, nil
+	}
+	links := make([]transform.Transformer, len(p.links))
+	for i, link := range p.links {
+		links[i] = link()
+	}
+	return transform.Chain(links...), nil
+}
+
+/* Reader returns a reader applying the pipeline to r. */
+func (p *Pipeline) Reader(r io.Reader) (io.Reader, error) {
+	t, err := p.Transformer()
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewReader(r, t), nil
+}
+
+/* Writer returns a writer applying the pipeline to the bytes written to w, Close flushes them and doesn't close w. */
+func (p *Pipeline) Writer(w io.Writer) (io.WriteCloser, error) {
+	t, err := p.Transformer()
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewWriter(w, t), nil
+}
+
+/* Copy copies src to dst through the pipeline, returns the number of bytes written. */
+func (p *Pipeline) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	r, err := p.Reader(src)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(dst, r)
+	if err != nil {
+		return n, wrapError(err)
+	}
+	return n, nil
+}
+
+/* RewriteFile applies the pipeline to the file in place, reading and writing it once. */
+func (p *Pipeline) RewriteFile(filePath string, opts RewriteOptions) error {
+	if p.err != nil {
+		return p.err
+	}
+	return RewriteFile(filePath, opts, func(r io.Reader, w io.Writer) error {
+		_, err := p.Copy(w, r)
+		return err
+	})
+}
+
+func (p *Pipeline) add(link func() transform.Transformer) *Pipeline {
+	p.links = append(p.links, link)
+	return p
+}
+
+func (p *Pipeline) fail(err error) *Pipeline {
+	if p.err == nil {
+		p.err = err
+	}
+	return p
+}
+
+/* byteSetTransformer drops the bytes of a set. */
+type byteSetTransformer struct {
+	transform.NopResetter
+	set *byteSet
+}
+
+func (t byteSetTransformer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	nSrc = copy(dst, src)
+	nDst = t.set.filter(dst[:nSrc])
+	if nSrc < len(src) {
+		return nDst, nSrc, transform.ErrShortDst
+	}
+	return nDst, nSrc, nil
+}
+
+/* literalReplacer replaces every occurrence of old with new. */
+type literalReplacer struct {
+	transform.NopResetter
+	old, new []byte
+}
+
+func (t literalReplacer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		i := bytes.Index(src[nSrc:], t.old)
+		run := i
+		if i < 0 {
+			run = len(src) - nSrc
+			if !atEOF {
+				run -= partialSuffix(src[nSrc:], t.old)
+			}
+		}
+		n := copy(dst[nDst:], src[nSrc:nSrc+run])
+		nDst += n
+		nSrc += n
+		if n < run {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		if i < 0 {
+			if nSrc < len(src) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			break
+		}
+		if len(dst)-nDst < len(t.new) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], t.new)
+		nSrc += len(t.old)
+	}
+	return nDst, nSrc, nil
+}
+
+/* partialSuffix returns the length of the longest end of data which starts the pattern without matching it whole. */
+func partialSuffix(data, pattern []byte) int {
+	k := len(pattern) - 1
+	if k > len(data) {
+		k = len(data)
+	}
+	for ; k > 0; k-- {
+		if bytes.HasSuffix(data, pattern[:k]) {
+			return k
+		}
+	}
+	return 0
+}
+
+/* trailingSpaceTrimmer holds back spaces and tabs until a byte shows whether they end a line. */
+type trailingSpaceTrimmer struct {
+	pending []byte
+}
+
+func (t *trailingSpaceTrimmer) Reset() {
+	t.pending = t.pending[:0]
+}
+
+func (t *trailingSpaceTrimmer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		b := src[nSrc]
+		switch b {
+		case ' ', '\t':
+			t.pending = append(t.pending, b)
+			nSrc++
+			continue
+		case '\n', '\r':
+			t.pending = t.pending[:0]
+		}
+		if len(t.pending) > 0 {
+			n := copy(dst[nDst:], t.pending)
+			nDst += n
+			t.pending = t.pending[:copy(t.pending, t.pending[n:])]
+			if len(t.pending) > 0 {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+		}
+
+		run := bytes.IndexAny(src[nSrc+1:], " \t\r\n") + 1
+		if run == 0 {
+			run = len(src) - nSrc
+		}
+		n := copy(dst[nDst:], src[nSrc:nSrc+run])
+		nDst += n
+		nSrc += n
+		if n < run {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+	}
+	if atEOF {
+		t.pending = t.pending[:0]
+	}
+	return nDst, nSrc, nil
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/runes"
+)
+
+func TestPipeline(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	testCases := []struct {
+		name     string
+		pipeline *Pipeline
+		data     string
+		expected string
+	}{
+		{"empty", NewPipeline(), "a\x00b\r\n", "a\x00b\r\n"},
+		{"nul", NewPipeline().RemoveBytes(), "a\x00b\x00", "ab"},
+		{"eol", NewPipeline().NormalizeLineEndings(LineEndingLF), "a\r\nb\rc\n", "a\nb\nc\n"},
+		{"delimiter", NewPipeline().ReplaceDelimiter("::", `\t`), "a::b:c::", "a\tb:c\t"},
+		{"delimiter name", NewPipeline().ReplaceDelimiter("del", "tab"), "a del b\x7f", "a \t b\x7f"},
+		{"trim", NewPipeline().TrimTrailingSpace(), "a  \nb\t \r\n c d \t", "a\nb\r\n c d"},
+		{"utf8", NewPipeline().ReplaceInvalidUTF8(), "caf\xe9,東京", "caf�,東京"},
+		{"delete utf8", NewPipeline().DeleteInvalidUTF8(), "caf\xe9,東京\xe4", "caf,東京"},
+		{"control", NewPipeline().StripControl(), "a\x01\tb\x1b[0m\x7f\r\n", "a\tb[0m\r\n"},
+		{"keep control", NewPipeline().StripControl('\n', 0x1f), "a\x1fb\tc\n", "a\x1fbc\n"},
+		{
+			"chain",
+			NewPipeline().RemoveBytes().NormalizeLineEndings(LineEndingLF).TrimTrailingSpace().ReplaceDelimiter(";", ","),
+			"id;name \r\n1;Zo\x00ë\t\r\n",
+			"id,name\n1,Zoë\n",
+		},
+	}
+	for _, testCase := range testCases {
+		/* One byte reads exercise every transform across buffer boundaries. */
+		for _, src := range []io.Reader{
+			strings.NewReader(testCase.data),
+			iotest.OneByteReader(strings.NewReader(testCase.data)),
+		} {
+			var out bytes.Buffer
+			_, err := testCase.pipeline.Copy(&out, src)
+			requirement.Nil(err, testCase.name)
+			assertion.Equal(testCase.expected, out.String(), testCase.name)
+		}
+
+		var out bytes.Buffer
+		w, err := testCase.pipeline.Writer(&out)
+		requirement.Nil(err)
+		for i := 0; i < len(testCase.data); i++ {
+			_, err = w.Write([]byte{testCase.data[i]})
+			requirement.Nil(err)
+		}
+		requirement.Nil(w.Close())
+		assertion.Equal(testCase.expected, out.String(), testCase.name)
+	}
+
+	long := strings.Repeat("ab \r\n", 50000)
+	r, err := NewPipeline().TrimTrailingSpace().NormalizeLineEndings(LineEndingLF).Reader(strings.NewReader(long))
+	requirement.Nil(err)
+	got, err := io.ReadAll(r)
+	requirement.Nil(err)
+	assertion.Equal(strings.Repeat("ab\n", 50000), string(got))
+
+	_, err = NewPipeline().NormalizeLineEndings("\n\n").RemoveBytes().Reader(strings.NewReader(""))
+	assertion.ErrorContains(err, "invalid line ending")
+	_, err = NewPipeline().ReplaceDelimiter("", ",").Reader(strings.NewReader(""))
+	assertion.ErrorContains(err, "empty delimiter")
+}
+
+func TestPipelineRewriteFile(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	file := filepath.Join(testDir, "dirty.csv")
+	requirement.Nil(os.WriteFile(file, []byte("a|b \r\nc\x00|d\r\n"), 0o640))
+
+	pipeline := NewPipeline().RemoveBytes().NormalizeLineEndings(LineEndingLF).TrimTrailingSpace().
+		ReplaceDelimiter("|", ",").Then(runes.Map(unicode.ToUpper))
+	requirement.Nil(pipeline.RewriteFile(file, RewriteOptions{}))
+	got, err := os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("A,B\nC,D\n", string(got))
+	requirement.Nil(os.RemoveAll(testDir))
+}
@@ -0,0 +1,390 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* The column types of a CSVSchema, a column of no type accepts any value. */
+const (
+	SchemaString  = "string"
+	SchemaInt     = "int"
+	SchemaDecimal = "decimal"
+	SchemaDate    = "date"
+	SchemaEnum    = "enum"
+	SchemaRegex   = "regex"
+	SchemaIP      = "ip"
+	SchemaIPv4    = "ipv4"
+	SchemaIPv6    = "ipv6"
+	SchemaCIDR    = "cidr"
+	SchemaURL     = "url"
+	SchemaDomain  = "domain"
+)
+
+/* The rules a SchemaViolation breaks. */
+const (
+	SchemaRuleHeader   = "header"
+	SchemaRuleColumns  = "columns"
+	SchemaRuleSyntax   = "syntax"
+	SchemaRuleRequired = "required"
+	SchemaRuleType     = "type"
+	SchemaRuleUnique   = "unique"
+)
+
+/*
+SchemaColumn declares a column of a CSVSchema. Layout is the Go time layout of a date, 2006-01-02 by default,
+Values lists the values of an enum and Pattern is the regular expression a regex value matches whole.
+An empty value breaks Required, otherwise it is null and not checked further.
+*/
+type SchemaColumn struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Layout   string   `json:"layout"`
+	Values   []string `json:"values"`
+	Pattern  string   `json:"pattern"`
+	Required bool     `json:"required"`
+	Unique   bool     `json:"unique"`
+}
+
+/*
+CSVSchema declares the header and the columns of a CSV file in order.
+Delimiter is read by ParseDelimiter, the comma when empty, and ExtraColumns allows columns after the declared ones.
+*/
+type CSVSchema struct {
+	Columns      []SchemaColumn `json:"columns"`
+	Delimiter    string         `json:"delimiter"`
+	ExtraColumns bool           `json:"extra_columns"`
+}
+
+/*
+SchemaViolation reports a value breaking a rule of the schema. Row counts the records from 1, the header included,
+and Line is the line the record starts on.
+*/
+type SchemaViolation struct {
+	Row     int64  `json:"row"`
+	Line    int64  `json:"line"`
+	Column  string `json:"column"`
+	Rule    string `json:"rule"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+/* SchemaReport counts the validated rows below the header and holds every violation. */
+type SchemaReport struct {
+	Rows       int64
+	Violations []SchemaViolation
+}
+
+/* Valid reports whether no rule was broken. */
+func (r SchemaReport) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+/* LoadCSVSchema parses the JSON schema and checks its columns. */
+func LoadCSVSchema(data []byte) (CSVSchema, error) {
+	var schema CSVSchema
+	if err := JSONUnmarshal(data, &schema); err != nil {
+		return schema, wrapError(err)
+	}
+	_, err := schema.compile()
+	return schema, err
+}
+
+/* LoadCSVSchemaFile reads the JSON schema from the file. */
+func LoadCSVSchemaFile(filePath string) (CSVSchema, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return CSVSchema{}, wrapError(err)
+	}
+	return LoadCSVSchema(data)
+}
+
+/* ValidateCSV streams the CSV of r against the schema and collects every violation. */
+func ValidateCSV(r io.Reader, schema CSVSchema) (SchemaReport, error) {
+	var report SchemaReport
+	rows, err := ValidateCSVFunc(r, schema, func(v SchemaViolation) error {
+		report.Violations = append(report.Violations, v)
+		return nil
+	})
+	report.Rows = rows
+	return report, err
+}
+
+/*
+ValidateCSVFile validates the CSV file against the schema and writes the violations to reportFile unless it is empty,
+as JSON for a .json file and as CSV otherwise.
+*/
+func ValidateCSVFile(filePath string, schema CSVSchema, reportFile string) (SchemaReport, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return SchemaReport{}, wrapError(err)
+	}
+	defer f.Close()
+	report, err := ValidateCSV(f, schema)
+	if err != nil || reportFile == "" {
+		return report, err
+	}
+	err = writePartFile(reportFile, func(w io.Writer) error {
+		return WriteSchemaReport(w, report.Violations, filepath.Ext(reportFile))
+	})
+	if err != nil {
+		return report, wrapError(err)
+	}
+	return report, nil
+}
+
+/*
+ValidateCSVFunc streams the CSV of r against the schema and calls fn with every violation as it is found,
+an error of fn stops the validation. Returns the number of rows below the header.
+*/
+func ValidateCSVFunc(r io.Reader, schema CSVSchema, fn func(SchemaViolation) error) (int64, error) {
+	columns, err := schema.compile()
+	if err != nil {
+		return 0, err
+	}
+	comma := ','
+	if schema.Delimiter != "" {
+		if comma, err = ParseDelimiter(schema.Delimiter); err != nil {
+			return 0, err
+		}
+	}
+	reader := csv.NewReader(bufio.NewReaderSize(r, 64*1024))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	seen := make([]map[string]int64, len(columns))
+	for i, column := range columns {
+		if column.Unique {
+			seen[i] = make(map[string]int64)
+		}
+	}
+	var rows int64
+	for row := int64(1); ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			if row == 1 {
+				return 0, fn(SchemaViolation{Row: 1, Line: 1, Rule: SchemaRuleHeader, Message: "missing header row"})
+			}
+			return rows, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			v := SchemaViolation{Row: row, Line: int64(parseErr.StartLine), Rule: SchemaRuleSyntax, Message: parseErr.Err.Error()}
+			if err = fn(v); err != nil {
+				return rows, err
+			}
+			continue
+		}
+		if err != nil {
+			return rows, wrapError(err)
+		}
+		line, _ := reader.FieldPos(0)
+		report := func(column, rule, value, format string, args ...any) error {
+			return fn(SchemaViolation{
+				Row: row, Line: int64(line), Column: column, Rule: rule, Value: value, Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		if len(record) < len(columns) || len(record) > len(columns) && !schema.ExtraColumns {
+			if err = report("", SchemaRuleColumns, "", "%d fields, expected %d", len(record), len(columns)); err != nil {
+				return rows, err
+			}
+		}
+		if row == 1 {
+			for i, column := range columns {
+				name := ""
+				if i < len(record) {
+					name = strings.TrimPrefix(record[i], "\ufeff")
+				}
+				if name != column.Name {
+					if err = report(column.Name, SchemaRuleHeader, name, "expected column %q", column.Name); err != nil {
+						return rows, err
+					}
+				}
+			}
+			continue
+		}
+
+		rows++
+		for i, column := range columns {
+			if i >= len(record) {
+				break
+			}
+			value := record[i]
+			if value == "" {
+				if column.Required {
+					if err = report(column.Name, SchemaRuleRequired, value, "value is required"); err != nil {
+						return rows, err
+					}
+				}
+				continue
+			}
+			if msg := column.check(value); msg != "" {
+				if err = report(column.Name, SchemaRuleType, value, "%s", msg); err != nil {
+					return rows, err
+				}
+			}
+			if seen[i] == nil {
+				continue
+			}
+			if first, ok := seen[i][value]; ok {
+				if err = report(column.Name, SchemaRuleUnique, value, "duplicate of row %d", first); err != nil {
+					return rows, err
+				}
+				continue
+			}
+			seen[i][value] = row
+		}
+	}
+}
+
+/* WriteSchemaReport writes the violations to w as a JSON array when ext is .json, otherwise as CSV with a header row. */
+func WriteSchemaReport(w io.Writer, violations []SchemaViolation, ext string) error {
+	buf := bufio.NewWriter(w)
+	if strings.EqualFold(ext, ".json") {
+		buf.WriteByte('[')
+		for i, v := range violations {
+			data, err := JSONMarshal(v)
+			if err != nil {
+				return wrapError(err)
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString("\n  ")
+			buf.Write(data)
+		}
+		if len(violations) > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("]\n")
+	} else {
+		writer := csv.NewWriter(buf)
+		if err := writer.Write([]string{"row", "line", "column", "rule", "value", "message"}); err != nil {
+			return wrapError(err)
+		}
+		for _, v := range violations {
+			record := []string{strconv.FormatInt(v.Row, 10), strconv.FormatInt(v.Line, 10), v.Column, v.Rule, v.Value, v.Message}
+			if err := writer.Write(record); err != nil {
+				return wrapError(err)
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return wrapError(err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return wrapError(err)
+	}
+	return nil
+}
+
+/* schemaColumn is a SchemaColumn ready to check values. */
+type schemaColumn struct {
+	SchemaColumn
+	pattern *regexp.Regexp
+	values  map[string]bool
+}
+
+/* schemaDecimal matches the plain decimal numbers, of any precision. */
+var schemaDecimal = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)$`)
+
+/* compile checks the columns of the schema and prepares their patterns and enums. */
+func (schema CSVSchema) compile() ([]schemaColumn, error) {
+	if len(schema.Columns) == 0 {
+		return nil, wrapError(errors.New("schema has no columns"))
+	}
+	columns := make([]schemaColumn, len(schema.Columns))
+	used := make(map[string]bool)
+	for i, c := range schema.Columns {
+		column := schemaColumn{SchemaColumn: c}
+		switch {
+		case c.Name == "":
+			return nil, wrapError(fmt.Errorf("schema column %d has no name", i+1))
+		case used[c.Name]:
+			return nil, wrapError(fmt.Errorf("schema column %q is duplicated", c.Name))
+		}
+		used[c.Name] = true
+		switch c.Type {
+		case "", SchemaString, SchemaInt, SchemaDecimal, SchemaIP, SchemaIPv4, SchemaIPv6, SchemaCIDR, SchemaURL, SchemaDomain:
+		case SchemaDate:
+			if column.Layout == "" {
+				column.Layout = "2006-01-02"
+			}
+		case SchemaEnum:
+			if len(c.Values) == 0 {
+				return nil, wrapError(fmt.Errorf("schema column %q has no enum values", c.Name))
+			}
+			column.values = make(map[string]bool, len(c.Values))
+			for _, v := range c.Values {
+				column.values[v] = true
+			}
+		case SchemaRegex:
+			re, err := regexp.Compile(`^(?:` + c.Pattern + `)$`)
+			if err != nil {
+				return nil, wrapError(fmt.Errorf("schema column %q: %w", c.Name, err))
+			}
+			column.pattern = re
+		default:
+			return nil, wrapError(fmt.Errorf("schema column %q has an unknown type %q", c.Name, c.Type))
+		}
+		columns[i] = column
+	}
+	return columns, nil
+}
+
+/* check returns why the non-empty value is not of the column type, "" when it is. */
+func (c schemaColumn) check(value string) string {
+	var ok bool
+	switch c.Type {
+	case SchemaInt:
+		_, err := strconv.ParseInt(value, 10, 64)
+		ok = err == nil
+	case SchemaDecimal:
+		ok = schemaDecimal.MatchString(value)
+	case SchemaDate:
+		if _, err := time.Parse(c.Layout, value); err != nil {
+			return fmt.Sprintf("not a date in layout %s", c.Layout)
+		}
+		return ""
+	case SchemaEnum:
+		if !c.values[value] {
+			return fmt.Sprintf("not one of %s", strings.Join(c.Values, ", "))
+		}
+		return ""
+	case SchemaRegex:
+		if !c.pattern.MatchString(value) {
+			return fmt.Sprintf("does not match %s", c.Pattern)
+		}
+		return ""
+	case SchemaIP:
+		ok = IsIP(value)
+	case SchemaIPv4:
+		ok = IsIPv4(value)
+	case SchemaIPv6:
+		ok = IsIPv6(value)
+	case SchemaCIDR:
+		ok = IsCIDR(value)
+	case SchemaURL:
+		ok = IsURL(value)
+	case SchemaDomain:
+		ok = IsDomain(value)
+	default:
+		return ""
+	}
+	if ok {
+		return ""
+	}
+	return "not a valid " + c.Type
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCSVSchema = `{
+	"columns": [
+		{"name": "id", "type": "int", "required": true, "unique": true},
+		{"name": "amount", "type": "decimal"},
+		{"name": "day", "type": "date", "layout": "02/01/2006"},
+		{"name": "status", "type": "enum", "values": ["open", "closed"]},
+		{"name": "code", "type": "regex", "pattern": "[A-Z]{2}-\\d+"},
+		{"name": "host", "type": "ip"},
+		{"name": "site", "type": "url"},
+		{"name": "zone", "type": "domain"}
+	]
+}`
+
+func TestValidateCSV(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	schema, err := LoadCSVSchema([]byte(testCSVSchema))
+	requirement.Nil(err)
+
+	data := strings.Join([]string{
+		"id,amount,day,status,code,host,site,zone",
+		"1,12.50,30/06/2023,open,AB-1,10.0.0.1,https://example.com/a,example.com",
+		"2,,,,,,,",
+		"x,1e5,2023-06-30,pending,ab-1,10.0.0.256,example,localhost",
+		"1,0.5,01/07/2023,closed,CD-22,::1,http://a.io,a.io",
+		",1",
+		`3,"1,5",,,,,,`,
+	}, "\n") + "\n"
+	report, err := ValidateCSV(strings.NewReader(data), schema)
+	requirement.Nil(err)
+	assertion.Equal(int64(6), report.Rows)
+	assertion.False(report.Valid())
+
+	type violation struct {
+		row    int64
+		column string
+		rule   string
+	}
+	var got []violation
+	for _, v := range report.Violations {
+		got = append(got, violation{v.Row, v.Column, v.Rule})
+	}
+	assertion.Equal([]violation{
+		{4, "id", SchemaRuleType},
+		{4, "amount", SchemaRuleType},
+		{4, "day", SchemaRuleType},
+		{4, "status", SchemaRuleType},
+		{4, "code", SchemaRuleType},
+		{4, "host", SchemaRuleType},
+		{4, "site", SchemaRuleType},
+		{4, "zone", SchemaRuleType},
+		{5, "id", SchemaRuleUnique},
+		{6, "", SchemaRuleColumns},
+		{6, "id", SchemaRuleRequired},
+		{7, "amount", SchemaRuleType},
+	}, got)
+	assertion.Equal("duplicate of row 2", report.Violations[8].Message)
+	assertion.Equal("not one of open, closed", report.Violations[3].Message)
+
+	report, err = ValidateCSV(strings.NewReader("\ufeffid;amount;extra\n1;2;3\n"), CSVSchema{
+		Columns:      []SchemaColumn{{Name: "id", Type: SchemaInt}, {Name: "value", Type: SchemaDecimal}},
+		Delimiter:    "semicolon",
+		ExtraColumns: true,
+	})
+	requirement.Nil(err)
+	requirement.Len(report.Violations, 1)
+	assertion.Equal(SchemaViolation{Row: 1, Line: 1, Column: "value", Rule: SchemaRuleHeader, Value: "amount", Message: `expected column "value"`}, report.Violations[0])
+
+	report, err = ValidateCSV(strings.NewReader("id\n1\n\"2\n"), CSVSchema{Columns: []SchemaColumn{{Name: "id"}}})
+	requirement.Nil(err)
+	requirement.Len(report.Violations, 1)
+	assertion.Equal(SchemaRuleSyntax, report.Violations[0].Rule)
+	assertion.Equal(int64(3), report.Violations[0].Line)
+}
+
+func TestValidateCSVFile(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "data.csv")
+	requirement.Nil(os.WriteFile(srcFile, []byte("id,ip\n1,10.0.0.1\n2,nowhere\n"), os.ModePerm))
+	schema := CSVSchema{Columns: []SchemaColumn{{Name: "id", Type: SchemaInt}, {Name: "ip", Type: SchemaIP}}}
+
+	testCases := []struct {
+		reportFile string
+		expected   string
+	}{
+		{"report.csv", "row,line,column,rule,value,message\n3,3,ip,type,nowhere,not a valid ip\n"},
+		{"report.json", "[\n  " + `{"row":3,"line":3,"column":"ip","rule":"type","value":"nowhere","message":"not a valid ip"}` + "\n]\n"},
+	}
+	for _, testCase := range testCases {
+		reportFile := filepath.Join(testDir, testCase.reportFile)
+		report, err := ValidateCSVFile(srcFile, schema, reportFile)
+		requirement.Nil(err)
+		assertion.Equal(int64(2), report.Rows)
+		got, err := os.ReadFile(reportFile)
+		requirement.Nil(err)
+		assertion.Equal(testCase.expected, string(got))
+	}
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestLoadCSVSchema(t *testing.T) {
+	assertion := assert.New(t)
+	testCases := []struct {
+		name     string
+		schema   string
+		expected string
+	}{
+		{"Empty", `{"columns": []}`, "no columns"},
+		{"Name", `{"columns": [{"type": "int"}]}`, "has no name"},
+		{"Duplicate", `{"columns": [{"name": "a"}, {"name": "a"}]}`, "duplicated"},
+		{"Type", `{"columns": [{"name": "a", "type": "money"}]}`, "unknown type"},
+		{"Enum", `{"columns": [{"name": "a", "type": "enum"}]}`, "no enum values"},
+		{"Regex", `{"columns": [{"name": "a", "type": "regex", "pattern": "("}]}`, "missing closing )"},
+	}
+	for _, testCase := range testCases {
+		_, err := LoadCSVSchema([]byte(testCase.schema))
+		assertion.ErrorContains(err, testCase.expected, testCase.name)
+	}
+}
@@ -0,0 +1,558 @@
+package utils
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+/* xlsxBook is a workbook opened by excelize, archive is only opened for the options needing cell metadata. */
+type xlsxBook struct {
+	file    *excelize.File
+	archive *excelArchive
+}
+
+/* xlsxSource returns the excelSource opening the workbook and, when the options need it, its archive. */
+func xlsxSource(openFile func() (*excelize.File, error), openArchive func() (*excelArchive, error)) excelSource {
+	return func(opts ExcelOptions) (spreadsheet, error) {
+		file, err := openFile()
+		if err != nil {
+			return nil, err
+		}
+		book := &xlsxBook{file: file}
+		if opts.needsArchive() {
+			if book.archive, err = openArchive(); err != nil {
+				file.Close()
+				return nil, wrapError(err)
+			}
+		}
+		return book, nil
+	}
+}
+
+func (b *xlsxBook) sheets() []string {
+	return b.file.GetSheetList()
+}
+
+func (b *xlsxBook) visible(sheet string) (bool, error) {
+	return b.file.GetSheetVisible(sheet)
+}
+
+func (b *xlsxBook) rows(sheet string, opts ExcelOptions) (func() ([]string, error), func(), error) {
+	return sheetRows(b.file, b.archive, sheet, opts)
+}
+
+func (b *xlsxBook) close() {
+	if err := b.file.Close(); err != nil {
+		printError(err)
+	}
+	if b.archive != nil {
+		if err := b.archive.Close(); err != nil {
+			printError(err)
+		}
+	}
+}
+
+/*
+excelArchive gives access to the worksheet parts of the workbook package,
+the Rows iterator only exposes cell values.
+*/
+type excelArchive struct {
+	reader *zip.Reader
+	closer io.Closer
+	paths  map[string]string
+}
+
+/* openExcelArchive opens the workbook package and maps every sheet name to its part path. */
+func openExcelArchive(filePath string) (*excelArchive, error) {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	archive := &excelArchive{reader: &zr.Reader, closer: zr}
+	if err = archive.readPaths(); err != nil {
+		zr.Close()
+		return nil, err
+	}
+	return archive, nil
+}
+
+/* readExcelArchive is openExcelArchive for a workbook package held in memory. */
+func readExcelArchive(r io.ReaderAt, size int64) (*excelArchive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	archive := &excelArchive{reader: zr, closer: io.NopCloser(nil)}
+	if err = archive.readPaths(); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+/* Close closes the workbook package. */
+func (a *excelArchive) Close() error {
+	return a.closer.Close()
+}
+
+/* readPaths resolves the part path of every sheet through the package and workbook relationships. */
+func (a *excelArchive) readPaths() error {
+	type relationships struct {
+		Relationship []struct {
+			ID     string `xml:"Id,attr"`
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+		}
+	}
+	var rels relationships
+	if err := a.decode("_rels/.rels", &rels); err != nil {
+		return err
+	}
+	workbook := "xl/workbook.xml"
+	for _, rel := range rels.Relationship {
+		if strings.HasSuffix(rel.Type, "/officeDocument") {
+			workbook = strings.TrimPrefix(rel.Target, "/")
+		}
+	}
+
+	var wb struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := a.decode(workbook, &wb); err != nil {
+		return err
+	}
+	rels = relationships{}
+	dir, base := path.Split(workbook)
+	if err := a.decode(dir+"_rels/"+base+".rels", &rels); err != nil {
+		return err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationship {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join(dir, rel.Target)
+		}
+	}
+	a.paths = make(map[string]string)
+	for _, sheet := range wb.Sheets {
+		a.paths[sheet.Name] = targets[sheet.ID]
+	}
+	return nil
+}
+
+/* open returns the XML stream of the part. */
+func (a *excelArchive) open(name string) (io.ReadCloser, error) {
+	for _, file := range a.reader.File {
+		if strings.EqualFold(file.Name, name) {
+			return file.Open()
+		}
+	}
+	return nil, fmt.Errorf("part %s not found", name)
+}
+
+/* decode unmarshals the XML part into v. */
+func (a *excelArchive) decode(name string, v any) error {
+	r, err := a.open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return xml.NewDecoder(r).Decode(v)
+}
+
+/* sheetXMLRow maps the row element of a worksheet part. */
+type sheetXMLRow struct {
+	R int            `xml:"r,attr"`
+	C []sheetXMLCell `xml:"c"`
+}
+
+/* sheetXMLCell maps the c element of a worksheet part. */
+type sheetXMLCell struct {
+	R string `xml:"r,attr"`
+	S int    `xml:"s,attr"`
+	T string `xml:"t,attr"`
+	V string `xml:"v"`
+	F *struct {
+		Content string `xml:",chardata"`
+		T       string `xml:"t,attr"`
+		Si      *int   `xml:"si,attr"`
+	} `xml:"f"`
+}
+
+/* sheetRange is a merged range in 1-based cell coordinates. */
+type sheetRange struct {
+	col, row, endCol, endRow int
+	value                    string
+}
+
+/*
+sheetCells rewrites the rows of the Rows iterator with metadata streamed from the worksheet part:
+formula text, ISO-8601 dates and merged range values.
+*/
+type sheetCells struct {
+	opts     ExcelOptions
+	decoder  *xml.Decoder
+	closer   io.Closer
+	layouts  map[int]string
+	date1904 bool
+	merged   []*sheetRange
+	lastRow  int
+	next     *sheetXMLRow
+	done     bool
+	shared   map[int]sheetXMLCell
+}
+
+/* newSheetCells opens the worksheet part of the sheet, merged ranges are collected by a first pass over it. */
+func newSheetCells(excelFile *excelize.File, archive *excelArchive, sheetName string, opts ExcelOptions) (*sheetCells, error) {
+	name, ok := archive.paths[sheetName]
+	if !ok {
+		return nil, excelize.ErrSheetNotExist{SheetName: sheetName}
+	}
+	s := &sheetCells{opts: opts, shared: make(map[int]sheetXMLCell)}
+	if opts.ISODates {
+		props, err := excelFile.GetWorkbookProps()
+		if err != nil {
+			return nil, err
+		}
+		s.date1904 = props.Date1904 != nil && *props.Date1904
+		s.layouts = dateLayouts(excelFile)
+	}
+	if opts.FillMerged {
+		merged, err := archive.mergedRanges(name)
+		if err != nil {
+			return nil, err
+		}
+		s.merged = merged
+		for _, r := range merged {
+			if r.endRow > s.lastRow {
+				s.lastRow = r.endRow
+			}
+		}
+	}
+	if opts.ISODates || opts.FormulaText {
+		r, err := archive.open(name)
+		if err != nil {
+			return nil, err
+		}
+		s.decoder, s.closer = xml.NewDecoder(r), r
+	}
+	return s, nil
+}
+
+/* Close closes the worksheet part. */
+func (s *sheetCells) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+/* mergedRanges reads the mergeCell elements of the worksheet part. */
+func (a *excelArchive) mergedRanges(name string) ([]*sheetRange, error) {
+	r, err := a.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var merged []*sheetRange
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return merged, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "sheetData":
+			if err = decoder.Skip(); err != nil {
+				return nil, err
+			}
+		case "mergeCell":
+			for _, attr := range start.Attr {
+				if attr.Name.Local != "ref" {
+					continue
+				}
+				cells := strings.Split(attr.Value, ":")
+				var v sheetRange
+				if v.col, v.row, err = excelize.CellNameToCoordinates(cells[0]); err != nil {
+					return nil, err
+				}
+				v.endCol, v.endRow = v.col, v.row
+				if len(cells) == 2 {
+					if v.endCol, v.endRow, err = excelize.CellNameToCoordinates(cells[1]); err != nil {
+						return nil, err
+					}
+				}
+				merged = append(merged, &v)
+			}
+		}
+	}
+}
+
+/* rowCells returns the cells of the row numbered n by column, nil when the row is not in the part. */
+func (s *sheetCells) rowCells(n int) (map[int]sheetXMLCell, error) {
+	for s.decoder != nil && !s.done && (s.next == nil || s.next.R < n) {
+		last := 0
+		if s.next != nil {
+			last = s.next.R
+		}
+		s.next = nil
+		for s.next == nil {
+			token, err := s.decoder.Token()
+			if err == io.EOF {
+				s.done = true
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			start, ok := token.(xml.StartElement)
+			if !ok || start.Name.Local != "row" {
+				continue
+			}
+			row := new(sheetXMLRow)
+			if err = s.decoder.DecodeElement(row, &start); err != nil {
+				return nil, err
+			}
+			if row.R == 0 {
+				row.R = last + 1
+			}
+			s.next = row
+		}
+	}
+	if s.next == nil || s.next.R != n {
+		return nil, nil
+	}
+	cells := make(map[int]sheetXMLCell, len(s.next.C))
+	col := 0
+	for _, c := range s.next.C {
+		col++
+		if c.R != "" {
+			var err error
+			if col, _, err = excelize.CellNameToCoordinates(c.R); err != nil {
+				return nil, err
+			}
+		} else {
+			c.R, _ = excelize.CoordinatesToCellName(col, n)
+		}
+		if c.F != nil && c.F.T == "shared" && c.F.Si != nil && c.F.Content != "" {
+			s.shared[*c.F.Si] = c
+		}
+		cells[col] = c
+	}
+	return cells, nil
+}
+
+/* apply rewrites the values of the row numbered n. */
+func (s *sheetCells) apply(n int, row []string) ([]string, error) {
+	cells, err := s.rowCells(n)
+	if err != nil {
+		return nil, err
+	}
+	for col, c := range cells {
+		var v string
+		var ok bool
+		if s.opts.FormulaText && c.F != nil {
+			v, ok = "="+s.formula(c), true
+		} else if layout := s.layouts[c.S]; layout != "" && (c.T == "" || c.T == "n") && c.V != "" {
+			serial, err := strconv.ParseFloat(c.V, 64)
+			if err != nil {
+				continue
+			}
+			t, err := excelize.ExcelDateToTime(serial, s.date1904)
+			if err != nil {
+				continue
+			}
+			v, ok = t.Format(layout), true
+		}
+		if ok {
+			for len(row) < col {
+				row = append(row, "")
+			}
+			row[col-1] = v
+		}
+	}
+	for _, r := range s.merged {
+		if n < r.row || n > r.endRow {
+			continue
+		}
+		if n == r.row && r.col <= len(row) {
+			r.value = row[r.col-1]
+		}
+		if r.value == "" {
+			continue
+		}
+		for len(row) < r.endCol {
+			row = append(row, "")
+		}
+		for col := r.col; col <= r.endCol; col++ {
+			row[col-1] = r.value
+		}
+	}
+	return row, nil
+}
+
+/* formula returns the formula text of the cell, shared formulas are shifted from their anchor cell like excelize does. */
+func (s *sheetCells) formula(c sheetXMLCell) string {
+	if c.F.T != "shared" || c.F.Si == nil || c.F.Content != "" {
+		return c.F.Content
+	}
+	anchor, ok := s.shared[*c.F.Si]
+	if !ok {
+		return ""
+	}
+	col, row, _ := excelize.CellNameToCoordinates(c.R)
+	anchorCol, anchorRow, _ := excelize.CellNameToCoordinates(anchor.R)
+	return shiftFormula(anchor.F.Content, col-anchorCol, row-anchorRow)
+}
+
+/* shiftFormula moves the relative cell references of the formula by dCol columns and dRow rows. */
+func shiftFormula(formula string, dCol, dRow int) string {
+	var (
+		res    strings.Builder
+		start  int
+		quoted bool
+	)
+	for end := 0; end < len(formula); end++ {
+		c := formula[end]
+		if c == '"' {
+			quoted = !quoted
+		}
+		if quoted || !(c >= 'A' && c <= 'Z' || c == '$') {
+			continue
+		}
+		res.WriteString(formula[start:end])
+		start = end
+		foundNum := false
+		for end++; end < len(formula); end++ {
+			c = formula[end]
+			if c >= '0' && c <= '9' || c == '$' {
+				foundNum = true
+			} else if !(c >= 'A' && c <= 'Z') || foundNum {
+				break
+			}
+		}
+		if foundNum && (end == len(formula) || formula[end] != '(') {
+			res.WriteString(shiftCell(formula[start:end], dCol, dRow))
+			start = end
+		}
+		end--
+	}
+	res.WriteString(formula[start:])
+	return res.String()
+}
+
+/* shiftCell moves the cell reference, absolute parts marked by $ are kept. */
+func shiftCell(cell string, dCol, dRow int) string {
+	col, row, err := excelize.CellNameToCoordinates(strings.ReplaceAll(cell, "$", ""))
+	if err != nil {
+		return cell
+	}
+	colSign, rowSign := "", ""
+	if strings.HasPrefix(cell, "$") {
+		colSign = "$"
+	} else {
+		col += dCol
+	}
+	if strings.LastIndex(cell, "$") > 0 {
+		rowSign = "$"
+	} else {
+		row += dRow
+	}
+	name, _ := excelize.ColumnNumberToName(col)
+	return colSign + name + rowSign + strconv.Itoa(row)
+}
+
+/* dateLayouts maps the index of every date or time cell style of the workbook to the ISO-8601 layout. */
+func dateLayouts(excelFile *excelize.File) map[int]string {
+	layouts := make(map[int]string)
+	if excelFile.Styles == nil || excelFile.Styles.CellXfs == nil {
+		return layouts
+	}
+	codes := make(map[int]string)
+	if excelFile.Styles.NumFmts != nil {
+		for _, numFmt := range excelFile.Styles.NumFmts.NumFmt {
+			codes[numFmt.NumFmtID] = numFmt.FormatCode
+		}
+	}
+	for i, xf := range excelFile.Styles.CellXfs.Xf {
+		if xf.NumFmtID == nil {
+			continue
+		}
+		if layout := numFmtLayout(*xf.NumFmtID, codes[*xf.NumFmtID]); layout != "" {
+			layouts[i] = layout
+		}
+	}
+	return layouts
+}
+
+/* numFmtLayout returns the ISO-8601 layout for a date, time or date-time number format, otherwise "". */
+func numFmtLayout(id int, code string) string {
+	const (
+		date     = "2006-01-02"
+		clock    = "15:04:05"
+		dateTime = date + "T" + clock
+	)
+	switch {
+	case id >= 14 && id <= 17, id >= 27 && id <= 31, id == 36, id >= 50 && id <= 58:
+		return date
+	case id >= 18 && id <= 21, id >= 32 && id <= 35, id == 45, id == 47:
+		return clock
+	case id == 22:
+		return dateTime
+	}
+	if code == "" {
+		return ""
+	}
+	var b strings.Builder
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; c {
+		case ';':
+			i = len(code)
+		case '\\', '_', '*':
+			i++
+		case '"':
+			for i++; i < len(code) && code[i] != '"'; i++ {
+			}
+		case '[':
+			j := strings.IndexByte(code[i:], ']')
+			if j < 0 {
+				j = len(code) - i
+			}
+			if strings.Trim(strings.ToLower(code[i+1:i+j]), "hms") == "" {
+				return ""
+			}
+			i += j
+		default:
+			b.WriteByte(c | 0x20)
+		}
+	}
+	hasDate := strings.ContainsAny(b.String(), "yd")
+	hasTime := strings.ContainsAny(b.String(), "hs")
+	switch {
+	case hasDate && hasTime:
+		return dateTime
+	case hasDate:
+		return date
+	case hasTime:
+		return clock
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNumFmtLayout(t *testing.T) {
+	assertion := assert.New(t)
+	testCases := []struct {
+		id       int
+		code     string
+		expected string
+	}{
+		{0, "", ""},
+		{14, "", "2006-01-02"},
+		{20, "", "15:04:05"},
+		{22, "", "2006-01-02T15:04:05"},
+		{164, "0.00%", ""},
+		{165, `#,##0 "days"`, ""},
+		{166, "[$-409]dd-mmm-yyyy;@", "2006-01-02"},
+		{167, "[h]:mm:ss", ""},
+		{168, "hh:mm AM/PM", "15:04:05"},
+		{169, "YYYY-MM-DD HH:MM", "2006-01-02T15:04:05"},
+		{170, `[Red]\d0.00`, ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.code, func(*testing.T) {
+			assertion.Equal(testCase.expected, numFmtLayout(testCase.id, testCase.code))
+		})
+	}
+}
+
+func TestShiftFormula(t *testing.T) {
+	assertion := assert.New(t)
+	testCases := []struct {
+		formula  string
+		expected string
+	}{
+		{"A1*2", "B3*2"},
+		{"SUM($A1:A$1)+$B$2", "SUM($A3:B$1)+$B$2"},
+		{`IF(C1="A1",1,0)`, `IF(D3="A1",1,0)`},
+		{"Sheet2!A1+LOG10(A2)", "Sheet2!B3+LOG10(B4)"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.formula, func(*testing.T) {
+			assertion.Equal(testCase.expected, shiftFormula(testCase.formula, 1, 2))
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+SplitOptions configures SplitFile.
+
+A part holds at most Rows records and at most Bytes bytes, the header included, at least one record is written
+to every part whatever its size. Delimiter is chosen by the file extension when it is 0 and the first row is
+a header repeated at the top of every part unless NoHeader is set. The parts are written to DstDir,
+the directory of the source file when it is empty.
+*/
+type SplitOptions struct {
+	Rows      int64
+	Bytes     int64
+	Delimiter rune
+	NoHeader  bool
+	DstDir    string
+}
+
+/* MergeOptions configures MergeFiles, Delimiter is chosen by the extension of every file when it is 0. */
+type MergeOptions struct {
+	Delimiter rune
+	NoHeader  bool
+}
+
+/*
+SplitFile splits the delimited file into parts named like data-0001.csv after the source file and returns their paths.
+Records are cut whole, so a quoted field spanning lines is never split.
+*/
+func SplitFile(srcFile string, opts SplitOptions) ([]string, error) {
+	if opts.Rows <= 0 && opts.Bytes <= 0 {
+		return nil, wrapError(errors.New("split needs a number of rows or bytes per part"))
+	}
+	if opts.Delimiter == 0 {
+		opts.Delimiter = delimiterByExt(srcFile)
+	}
+	if opts.DstDir == "" {
+		opts.DstDir = filepath.Dir(srcFile)
+	}
+	f, err := os.Open(srcFile)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, 64*1024)
+	head, _ := br.Peek(br.Size())
+	reader := newTextReader(br, opts.Delimiter)
+	var encoded bytes.Buffer
+	writer := csv.NewWriter(&encoded)
+	writer.Comma = opts.Delimiter
+	writer.UseCRLF = sniffLineEnding(head) == LineEndingCRLF
+	next := func() ([]byte, error) {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		encoded.Reset()
+		writer.Write(record)
+		writer.Flush()
+		if err = writer.Error(); err != nil {
+			return nil, wrapError(err)
+		}
+		return append([]byte(nil), encoded.Bytes()...), nil
+	}
+
+	var header []byte
+	if !opts.NoHeader {
+		if header, err = next(); err != nil {
+			return nil, err
+		}
+	}
+	pending, err := next()
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(srcFile)
+	base := strings.TrimSuffix(filepath.Base(srcFile), ext)
+	var parts []string
+	for pending != nil {
+		part := filepath.Join(opts.DstDir, fmt.Sprintf("%s-%04d%s", base, len(parts)+1, ext))
+		err = writePartFile(part, func(w io.Writer) error {
+			buf := bufio.NewWriter(w)
+			buf.Write(header)
+			size, rows := int64(len(header)), int64(0)
+			for pending != nil {
+				if rows > 0 && (opts.Rows > 0 && rows >= opts.Rows || opts.Bytes > 0 && size+int64(len(pending)) > opts.Bytes) {
+					break
+				}
+				if _, err := buf.Write(pending); err != nil {
+					return err
+				}
+				size += int64(len(pending))
+				rows++
+				var err error
+				if pending, err = next(); err != nil {
+					return err
+				}
+			}
+			return buf.Flush()
+		})
+		if err != nil {
+			return parts, wrapError(err)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+/*
+MergeFiles concatenates the records of the delimited files into dstFile, written with the header of the first file
+unless NoHeader is set, and returns the number of records below it. Every file must have the same header,
+or the same number of fields in its first record with NoHeader.
+*/
+func MergeFiles(dstFile string, srcFiles []string, opts MergeOptions) (int64, error) {
+	if len(srcFiles) == 0 {
+		return 0, wrapError(errors.New("no files to merge"))
+	}
+	var records int64
+	err := writePartFile(dstFile, func(w io.Writer) error {
+		buf := bufio.NewWriter(w)
+		writer := csv.NewWriter(buf)
+		writer.Comma = opts.Delimiter
+		if writer.Comma == 0 {
+			writer.Comma = delimiterByExt(dstFile)
+		}
+		var columns []string
+		for i, srcFile := range srcFiles {
+			n, err := mergeFile(writer, srcFile, &columns, i == 0, opts)
+			records += n
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		return buf.Flush()
+	})
+	if err != nil {
+		return records, wrapError(err)
+	}
+	return records, nil
+}
+
+/* mergeFile writes the records of srcFile, checking its columns against those of the first file. */
+func mergeFile(writer *csv.Writer, srcFile string, columns *[]string, first bool, opts MergeOptions) (int64, error) {
+	f, err := os.Open(srcFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, 64*1024)
+	if first {
+		head, _ := br.Peek(br.Size())
+		writer.UseCRLF = sniffLineEnding(head) == LineEndingCRLF
+	}
+	comma := opts.Delimiter
+	if comma == 0 {
+		comma = delimiterByExt(srcFile)
+	}
+	reader := newTextReader(br, comma)
+
+	var records int64
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		if row == 0 {
+			if len(record) > 0 {
+				record[0] = strings.TrimPrefix(record[0], "\ufeff")
+			}
+			if first {
+				*columns = append([]string(nil), record...)
+			} else if opts.NoHeader && len(record) != len(*columns) {
+				return records, fmt.Errorf("%s has %d columns, expected %d", srcFile, len(record), len(*columns))
+			} else if !opts.NoHeader && strings.Join(record, "\x00") != strings.Join(*columns, "\x00") {
+				return records, fmt.Errorf("%s has the columns %s, expected %s",
+					srcFile, strings.Join(record, ","), strings.Join(*columns, ","))
+			}
+			if !opts.NoHeader {
+				if first {
+					if err = writer.Write(record); err != nil {
+						return records, err
+					}
+				}
+				continue
+			}
+		}
+		if err = writer.Write(record); err != nil {
+			return records, err
+		}
+		records++
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitFile(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	srcFile := filepath.Join(testDir, "data.csv")
+	data := "id,note\r\n1,a\r\n2,\"two\r\nlines\"\r\n3,c\r\n4,d\r\n5,e\r\n"
+	requirement.Nil(os.WriteFile(srcFile, []byte(data), os.ModePerm))
+
+	testCases := []struct {
+		name     string
+		opts     SplitOptions
+		expected []string
+	}{
+		{
+			"Rows", SplitOptions{Rows: 2},
+			[]string{"id,note\r\n1,a\r\n2,\"two\r\nlines\"\r\n", "id,note\r\n3,c\r\n4,d\r\n", "id,note\r\n5,e\r\n"},
+		},
+		{
+			"Bytes", SplitOptions{Bytes: 20},
+			[]string{"id,note\r\n1,a\r\n", "id,note\r\n2,\"two\r\nlines\"\r\n", "id,note\r\n3,c\r\n4,d\r\n", "id,note\r\n5,e\r\n"},
+		},
+		{
+			"NoHeader", SplitOptions{Rows: 3, NoHeader: true},
+			[]string{"id,note\r\n1,a\r\n2,\"two\r\nlines\"\r\n", "3,c\r\n4,d\r\n5,e\r\n"},
+		},
+	}
+	for _, testCase := range testCases {
+		testCase.opts.DstDir = filepath.Join(testDir, testCase.name)
+		createDir(testCase.opts.DstDir)
+		parts, err := SplitFile(srcFile, testCase.opts)
+		requirement.Nil(err, testCase.name)
+		requirement.Len(parts, len(testCase.expected), testCase.name)
+		for i, part := range parts {
+			assertion.Equal(filepath.Join(testCase.opts.DstDir, "data-000"+string(rune('1'+i))+".csv"), part)
+			b, err := os.ReadFile(part)
+			requirement.Nil(err)
+			assertion.Equal(testCase.expected[i], string(b), testCase.name)
+		}
+
+		merged := filepath.Join(testCase.opts.DstDir, "merged.csv")
+		records, err := MergeFiles(merged, parts, MergeOptions{NoHeader: testCase.opts.NoHeader})
+		requirement.Nil(err, testCase.name)
+		b, err := os.ReadFile(merged)
+		requirement.Nil(err)
+		assertion.Equal(data, string(b), testCase.name)
+		if testCase.opts.NoHeader {
+			assertion.Equal(int64(6), records)
+		} else {
+			assertion.Equal(int64(5), records)
+		}
+	}
+
+	_, err := SplitFile(srcFile, SplitOptions{})
+	assertion.Error(err)
+	requirement.Nil(os.RemoveAll(testDir))
+}
+
+func TestMergeFiles(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	createDir(testDir)
+	first := filepath.Join(testDir, "a.csv")
+	second := filepath.Join(testDir, "b.tsv")
+	third := filepath.Join(testDir, "c.csv")
+	dstFile := filepath.Join(testDir, "all.csv")
+	requirement.Nil(os.WriteFile(first, []byte("\ufeffid,name\n1,amy\n"), os.ModePerm))
+	requirement.Nil(os.WriteFile(second, []byte("id\tname\n2\t\"b, c\"\n"), os.ModePerm))
+	requirement.Nil(os.WriteFile(third, []byte("id,title\n3,x\n"), os.ModePerm))
+
+	records, err := MergeFiles(dstFile, []string{first, second}, MergeOptions{})
+	requirement.Nil(err)
+	assertion.Equal(int64(2), records)
+	b, err := os.ReadFile(dstFile)
+	requirement.Nil(err)
+	assertion.Equal("id,name\n1,amy\n2,\"b, c\"\n", string(b))
+
+	_, err = MergeFiles(dstFile, []string{first, third}, MergeOptions{})
+	assertion.ErrorContains(err, "expected id,name")
+	_, err = MergeFiles(dstFile, []string{first, third}, MergeOptions{NoHeader: true})
+	assertion.Nil(err)
+	_, err = MergeFiles(dstFile, nil, MergeOptions{})
+	assertion.Error(err)
+	requirement.Nil(os.RemoveAll(testDir))
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+/* InvalidUTF8 locates an invalid byte, Line and Column count from 1 and Column counts characters. */
+type InvalidUTF8 struct {
+	Offset int64
+	Line   int64
+	Column int64
+	Byte   byte
+}
+
+/* UTF8Report counts the invalid bytes of an input and locates up to the limit of them given to ScanUTF8. */
+type UTF8Report struct {
+	Count   int64
+	Invalid []InvalidUTF8
+}
+
+/* UTF8Repair selects what RepairUTF8 does with an invalid byte. */
+type UTF8Repair int
+
+const (
+	/* UTF8Replace replaces every invalid byte with U+FFFD. */
+	UTF8Replace UTF8Repair = iota
+	/* UTF8Delete drops every invalid byte. */
+	UTF8Delete
+)
+
+/*
+ScanUTF8 reads r to the end and reports its bytes which are not part of a valid UTF-8 sequence,
+locating the first limit of them, all of them when limit is negative.
+*/
+func ScanUTF8(r io.Reader, limit int) (UTF8Report, error) {
+	var report UTF8Report
+	buf := make([]byte, 64*1024)
+	var carry int
+	offset, line, column := int64(0), int64(1), int64(1)
+	for {
+		n, err := r.Read(buf[carry:])
+		n += carry
+		atEOF := err == io.EOF
+		if err != nil && !atEOF {
+			return report, wrapError(err)
+		}
+
+		i := 0
+		for i < n {
+			b := buf[i]
+			size := 1
+			if b >= utf8.RuneSelf {
+				if !atEOF && !utf8.FullRune(buf[i:n]) {
+					break
+				}
+				var r rune
+				if r, size = utf8.DecodeRune(buf[i:n]); r == utf8.RuneError && size == 1 {
+					report.Count++
+					if limit < 0 || len(report.Invalid) < limit {
+						report.Invalid = append(report.Invalid, InvalidUTF8{Offset: offset, Line: line, Column: column, Byte: b})
+					}
+				}
+			}
+			if b == '\n' {
+				line++
+				column = 1
+			} else {
+				column++
+			}
+			offset += int64(size)
+			i += size
+		}
+		if atEOF {
+			return report, nil
+		}
+		carry = copy(buf, buf[i:n])
+	}
+}
+
+/* ScanFileUTF8 reads the file and reports its invalid UTF-8 like ScanUTF8. */
+func ScanFileUTF8(filePath string, limit int) (UTF8Report, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return UTF8Report{}, wrapError(err)
+	}
+	defer f.Close()
+	return ScanUTF8(f, limit)
+}
+
+/* RepairUTF8 copies src to dst fixing its invalid UTF-8 as mode says, returns the number of fixed bytes. */
+func RepairUTF8(dst io.Writer, src io.Reader, mode UTF8Repair) (int64, error) {
+	t := &utf8Repairer{mode: mode}
+	if _, err := io.Copy(dst, transform.NewReader(src, t)); err != nil {
+		return t.fixed, wrapError(err)
+	}
+	return t.fixed, nil
+}
+
+/* RepairFileUTF8 fixes the invalid UTF-8 of the file in place as opts say, returns the number of fixed bytes. */
+func RepairFileUTF8(filePath string, mode UTF8Repair, opts ...RewriteOptions) (int64, error) {
+	var fixed int64
+	err := RewriteFile(filePath, rewriteOptions(opts), func(r io.Reader, w io.Writer) error {
+		var err error
+		fixed, err = RepairUTF8(w, r, mode)
+		return err
+	})
+	return fixed, err
+}
+
+/* utf8Repairer replaces or drops the invalid bytes and counts them. */
+type utf8Repairer struct {
+	mode  UTF8Repair
+	fixed int64
+}
+
+func (t *utf8Repairer) Reset() {
+	t.fixed = 0
+}
+
+func (t *utf8Repairer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	const replacement = "�"
+	for nSrc < len(src) {
+		if b := src[nSrc]; b < utf8.RuneSelf {
+			if nDst == len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = b
+			nDst++
+			nSrc++
+			continue
+		}
+		if !atEOF && !utf8.FullRune(src[nSrc:]) {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		r, size := utf8.DecodeRune(src[nSrc:])
+		out := src[nSrc : nSrc+size]
+		invalid := r == utf8.RuneError && size == 1
+		if invalid {
+			out = []byte(replacement)
+			if t.mode == UTF8Delete {
+				out = nil
+			}
+		}
+		if len(dst)-nDst < len(out) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		if invalid {
+			t.fixed++
+		}
+		nDst += copy(dst[nDst:], out)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
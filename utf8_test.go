@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanUTF8(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	testCases := []struct {
+		name     string
+		data     string
+		limit    int
+		expected UTF8Report
+	}{
+		{"valid", "id,name\n1,東京\n", -1, UTF8Report{}},
+		{
+			"invalid", "id,name\n1,Caf\xe9\n2,東\xe4\xba", -1,
+			UTF8Report{Count: 3, Invalid: []InvalidUTF8{
+				{Offset: 13, Line: 2, Column: 6, Byte: 0xe9},
+				{Offset: 20, Line: 3, Column: 4, Byte: 0xe4},
+				{Offset: 21, Line: 3, Column: 5, Byte: 0xba},
+			}},
+		},
+		{"limit", "\xff\xfe\xfd", 1, UTF8Report{Count: 3, Invalid: []InvalidUTF8{{Offset: 0, Line: 1, Column: 1, Byte: 0xff}}}},
+	}
+	for _, testCase := range testCases {
+		got, err := ScanUTF8(iotest.HalfReader(strings.NewReader(testCase.data)), testCase.limit)
+		requirement.Nil(err)
+		assertion.Equal(testCase.expected, got, testCase.name)
+		assertion.Equal(testCase.expected.Count > 0, HasInvalidUTF8([]byte(testCase.data)), testCase.name)
+	}
+
+	/* A rune split across the 64 KiB reads is valid. */
+	data := append(bytes.Repeat([]byte{'a'}, 64*1024-1), "東\xff"...)
+	got, err := ScanUTF8(bytes.NewReader(data), -1)
+	requirement.Nil(err)
+	assertion.Equal(UTF8Report{Count: 1, Invalid: []InvalidUTF8{{Offset: int64(len(data) - 1), Line: 1, Column: 64*1024 + 1, Byte: 0xff}}}, got)
+}
+
+func TestRepairUTF8(t *testing.T) {
+	assertion := assert.New(t)
+	requirement := require.New(t)
+	testCases := []struct {
+		name     string
+		mode     UTF8Repair
+		data     string
+		expected string
+		fixed    int64
+	}{
+		{"valid", UTF8Replace, "Zoë,東京,�", "Zoë,東京,�", 0},
+		{"replace", UTF8Replace, "Caf\xe9,東\xe4\xba", "Caf�,東��", 3},
+		{"delete", UTF8Delete, "Caf\xe9,東\xe4\xba", "Caf,東", 3},
+	}
+	for _, testCase := range testCases {
+		var out bytes.Buffer
+		fixed, err := RepairUTF8(&out, iotest.OneByteReader(strings.NewReader(testCase.data)), testCase.mode)
+		requirement.Nil(err)
+		assertion.Equal(testCase.expected, out.String(), testCase.name)
+		assertion.Equal(testCase.fixed, fixed, testCase.name)
+	}
+
+	createDir(testDir)
+	file := filepath.Join(testDir, "latin1.csv")
+	requirement.Nil(os.WriteFile(file, []byte("id,name\n1,Caf\xe9\n"), 0o640))
+	report, err := ScanFileUTF8(file, -1)
+	requirement.Nil(err)
+	assertion.Equal(int64(1), report.Count)
+	fixed, err := RepairFileUTF8(file, UTF8Delete)
+	requirement.Nil(err)
+	assertion.Equal(int64(1), fixed)
+	b, err := os.ReadFile(file)
+	requirement.Nil(err)
+	assertion.Equal("id,name\n1,Caf\n", string(b))
+	requirement.Nil(os.RemoveAll(testDir))
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"io"
 	"net/netip"
 	"net/url"
@@ -8,34 +9,36 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-/* HasNullByteInFile checks the byte slice has the ASCII 0 or not. */
+/* HasNullByte checks the byte slice has the ASCII 0 or not. */
 func HasNullByte(data []byte) bool {
-	for _, b := range data {
-		if b == 0 {
-			return true
-		}
-	}
-	return false
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+/* HasInvalidUTF8 checks the byte slice has bytes which are not valid UTF-8, ScanUTF8 locates them. */
+func HasInvalidUTF8(data []byte) bool {
+	return !utf8.Valid(data)
 }
 
-/* HasNullByteInFile checks the file has the ASCII 0. */
+/* HasNullByteInFile checks the file has the ASCII 0, reading it up to the first one. Use ScanFileNullBytes to get the error. */
 func HasNullByteInFile(filePath string) bool {
-	data, err := os.ReadFile(filePath)
+	f, err := os.Open(filePath)
 	if err != nil {
 		logPanic(err)
 	}
-	return HasNullByte(data)
+	defer f.Close()
+	return HasNullByteInReader(f)
 }
 
-/* HasNullByteInReader checks the reader has the ASCII 0. */
+/* HasNullByteInReader checks the reader has the ASCII 0, reading it up to the first one. Use ScanNullBytes to get the error. */
 func HasNullByteInReader(r io.Reader) bool {
-	data, err := io.ReadAll(r)
+	scan, err := scanNullBytes(r, true)
 	if err != nil {
 		logPanic(err)
 	}
-	return HasNullByte(data)
+	return scan.First >= 0
 }
 
 /* IsDomain checks if i is a valid domain. */